@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/stretto-editor/gocui"
+)
+
+const buffersViewName = "Buffers - Enter to open, Ctrl+W/w to close, Ctrl+J/K to move"
+
+// ErrUnknownBuffer raised when switching to a buffer which is not opened
+var ErrUnknownBuffer = errors.New("no opened buffer with this name")
+
+// bufferOrder gives the order of the file views, in which they are listed
+// and cycled through
+var bufferOrder []string
+
+// fileViewNames returns the names of the views displaying files, in the
+// order of the buffers
+func fileViewNames() []string {
+	var names, others []string
+	seen := map[string]bool{}
+	// the views linked to another one are not buffers
+	for name := range linkedTo {
+		seen[name] = true
+	}
+	for _, name := range bufferOrder {
+		if info, ok := requiredViewsInfo[name]; ok && info.c == "main" && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	for name, info := range requiredViewsInfo {
+		if info.c == "main" && !seen[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	bufferOrder = append(names, others...)
+	return append([]string{}, bufferOrder...)
+}
+
+// fileViews returns the views displaying files, in the order of the buffers
+func fileViews(g *gocui.Gui) []*gocui.View {
+	var views []*gocui.View
+	for _, name := range fileViewNames() {
+		if v, err := g.View(name); err == nil {
+			views = append(views, v)
+		}
+	}
+	return views
+}
+
+// addBuffer puts the view at the end of the buffers
+func addBuffer(name string) {
+	removeBuffer(name)
+	bufferOrder = append(bufferOrder, name)
+}
+
+func removeBuffer(name string) {
+	tabbarStale = true
+	for i, n := range bufferOrder {
+		if n == name {
+			bufferOrder = append(bufferOrder[:i], bufferOrder[i+1:]...)
+			return
+		}
+	}
+}
+
+// moveBuffer moves the buffer of delta places in the buffers
+func moveBuffer(name string, delta int) {
+	names := fileViewNames()
+	for i, n := range names {
+		if n != name {
+			continue
+		}
+		j := i + delta
+		if j < 0 || j >= len(names) {
+			return
+		}
+		names[i], names[j] = names[j], names[i]
+		bufferOrder = names
+		tabbarStale = true
+		return
+	}
+}
+
+// showBuffer makes the file view the working view
+func showBuffer(g *gocui.Gui, name string) error {
+	v, err := g.View(name)
+	if err != nil {
+		return ErrUnknownBuffer
+	}
+	g.SetWorkingView(v.Name())
+	if g.CurrentMode().Name() != cmdMode {
+		g.SetCurrentView(v.Name())
+		g.SetViewOnTop(v.Name())
+	}
+	readOnlyFileMode(g)
+	updateInfos(g)
+	refreshTabBar(g)
+	return nil
+}
+
+// switchBuffer shows the buffer delta places after the working view
+func switchBuffer(g *gocui.Gui, delta int) error {
+	names := fileViewNames()
+	for i, name := range names {
+		if name == sourceOf(g.Workingview().Name()) {
+			return showBuffer(g, names[(i+delta+len(names))%len(names)])
+		}
+	}
+	return nil
+}
+
+func switchBufferForward(g *gocui.Gui, v *gocui.View) error {
+	return switchBuffer(g, 1)
+}
+
+func switchBufferBackward(g *gocui.Gui, v *gocui.View) error {
+	return switchBuffer(g, -1)
+}
+
+// writeBufferList writes a line for each buffer : its name, its markers, its
+// number of lines and the path of its file
+func writeBufferList(g *gocui.Gui, v *gocui.View, names []string) {
+	v.Clear()
+	for i, name := range names {
+		b, err := g.View(name)
+		if err != nil {
+			continue
+		}
+		path := filePath(b)
+		if abs, err := filepath.Abs(path); err == nil && path != "" {
+			path = abs
+		}
+		current := " "
+		if name == g.Workingview().Name() {
+			current = "%"
+		}
+		fmt.Fprintf(v, "%2d %s %-20s %-8s %6d lines  %s\n",
+			i+1, current, name, viewMarkers(b), b.BufferSize(), path)
+	}
+}
+
+func buffersHandler(g *gocui.Gui, v *gocui.View) error {
+	return displayBuffers(g, 0)
+}
+
+func buffersCmd(g *gocui.Gui, cmd []string) error {
+	return displayBuffers(g, 0)
+}
+
+// displayBuffers lists the buffers in a tmp view, the cursor on the line
+// selected
+func displayBuffers(g *gocui.Gui, selected int) error {
+	doSwitchMode(g, editMode)
+	g.DeleteView(buffersViewName)
+	v, err := newTmpView(g, buffersViewName)
+	if err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Wrap = false
+	v.Highlight = true
+	v.SelBgColor = setColor(userconfig.Selbgcolor)
+	v.SelFgColor = setColor(userconfig.Selfgcolor)
+	names := fileViewNames()
+	writeBufferList(g, v, names)
+	if selected >= len(names) {
+		selected = len(names) - 1
+	}
+	if selected < 0 {
+		selected = 0
+	}
+	v.SetCursor(0, selected)
+
+	selectedName := func(v *gocui.View) (string, bool) {
+		i := selectedLine(v)
+		if i < 0 || i >= len(names) {
+			return "", false
+		}
+		return names[i], true
+	}
+	tmpSelectHandlers[buffersViewName] = func(g *gocui.Gui, v *gocui.View) error {
+		name, ok := selectedName(v)
+		if !ok {
+			return nil
+		}
+		quitTmpView(g, v)
+		return showBuffer(g, name)
+	}
+	tmpCloseHandlers[buffersViewName] = func(g *gocui.Gui, v *gocui.View) error {
+		name, ok := selectedName(v)
+		if !ok {
+			return nil
+		}
+		line := selectedLine(v)
+		quitTmpView(g, v)
+		if err := showBuffer(g, name); err != nil {
+			return err
+		}
+		if isDirty(g.Workingview()) {
+			// the modifications are asked to be saved first
+			return closeFileHandler(g, g.Workingview())
+		}
+		closeView(g, g.Workingview())
+		return displayBuffers(g, line)
+	}
+	tmpMoveHandlers[buffersViewName] = func(g *gocui.Gui, v *gocui.View, delta int) error {
+		name, ok := selectedName(v)
+		if !ok {
+			return nil
+		}
+		moveBuffer(name, delta)
+		return displayBuffers(g, selectedLine(v)+delta)
+	}
+	g.SetViewOnTop(v.Name())
+	g.SetCurrentView(v.Name())
+	return nil
+}
+
+// bufferCmd switches to the buffer whose name is given in argument
+func bufferCmd(g *gocui.Gui, cmd []string) error {
+	return showBuffer(g, cmd[1])
+}
+
+// GetAutocompleteBuffer returns the name of the opened buffer beginning by
+// the prefix in argument
+func GetAutocompleteBuffer(prefix string, posArg int) string {
+	return autocompleteWord(prefix, fileViewNames())
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferList(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	openAndDisplayFile(g, "Commands.md")
+	openAndDisplayFile(g, "LICENSE")
+	assert.Equal(t, []string{"file", "Commands.md", "LICENSE"}, fileViewNames())
+
+	err := buffersCmd(g, []string{"buffers"})
+	assert.Nil(t, err, "No error should be found")
+	v := g.CurrentView()
+	assert.Equal(t, buffersViewName, v.Name())
+	lines := strings.Split(strings.TrimSpace(v.Buffer()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Contains(t, lines[2], "% LICENSE")
+
+	// move Commands.md down
+	v.SetCursor(0, 1)
+	moveTmpLineHandlerFactory(1)(g, v)
+	assert.Equal(t, []string{"file", "LICENSE", "Commands.md"}, fileViewNames())
+
+	// close file
+	v = g.CurrentView()
+	v.SetCursor(0, 0)
+	closeTmpLineHandler(g, v)
+	assert.Equal(t, []string{"LICENSE", "Commands.md"}, fileViewNames())
+
+	// open Commands.md
+	v = g.CurrentView()
+	v.SetCursor(0, 1)
+	selectTmpHandler(g, v)
+	assert.Equal(t, "Commands.md", g.Workingview().Name())
+	assert.Equal(t, "Commands.md", g.CurrentView().Name())
+
+	switchBufferForward(g, nil)
+	assert.Equal(t, "LICENSE", g.Workingview().Name())
+
+	assert.Nil(t, bufferCmd(g, []string{"b", "Commands.md"}))
+	assert.Equal(t, "Commands.md", g.Workingview().Name())
+	assert.Equal(t, ErrUnknownBuffer, bufferCmd(g, []string{"b", "foo"}))
+	assert.Equal(t, "Commands.md", GetAutocompleteBuffer("Co", 1))
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"math"
+	"os"
 	"strconv"
 
 	"github.com/stretto-editor/gocui"
@@ -22,6 +24,12 @@ var (
 	ErrMissingLine = errors.New("the number of the line to go to is missing")
 	// ErrGoToInWrapMode raised when the user try to use goto when wrap mode is active
 	ErrGoToInWrapMode = errors.New("goto not available when wrap is active")
+	// ErrMissingBufferName raised when the name of the buffer to switch to is missing
+	ErrMissingBufferName = errors.New("missing buffer name as argument")
+	// ErrMissingOption raised when the option or its value is missing in the set commands
+	ErrMissingOption = errors.New("expected an option and its value")
+	// ErrMissingThemeName raised when the theme command has no argument
+	ErrMissingThemeName = errors.New("missing theme name as argument")
 	// ErrNumberExpected raised when a number is expected in argument and other type was found
 	ErrNumberExpected = errors.New("illegal parameter, number expected")
 )
@@ -37,12 +45,35 @@ func initCommands() {
 	commands["setwrap"] = &Command{"setwrap", setWrapCmd, 1, 1, ErrWrapArgument, GetAutocompleteBoolean}
 	commands["open"] = &Command{"open", openCmd, 1, 1, ErrMissingFilename, GetAutocompleteFile}
 	commands["o"] = commands["open"]
+	commands["buffers"] = &Command{"buffers", buffersCmd, 0, 0, nil, nil}
+	commands["ls"] = commands["buffers"]
+	commands["b"] = &Command{"b", bufferCmd, 1, 1, ErrMissingBufferName, GetAutocompleteBuffer}
+	commands["buffer"] = commands["b"]
+	commands["split"] = &Command{"split", splitCmd, 0, 1, nil, GetAutocompleteFile}
+	commands["sp"] = commands["split"]
+	commands["vsplit"] = &Command{"vsplit", vsplitCmd, 0, 1, nil, GetAutocompleteFile}
+	commands["vs"] = commands["vsplit"]
+	commands["closepane"] = &Command{"closepane", closePaneCmd, 0, 0, nil, nil}
+	commands["unsplit"] = &Command{"unsplit", unsplitCmd, 0, 0, nil, nil}
+	commands["view"] = &Command{"view", viewCmd, 1, 1, ErrMissingFilename, GetAutocompleteFile}
 	commands["close"] = &Command{"close", closeCmd, 0, 0, nil, nil}
 	commands["c!"] = commands["close"]
 	commands["sc"] = &Command{"sc", saveAndClose, 0, 1, nil, GetAutocompleteFile}
-	commands["replaceall"] = &Command{"replaceall", replaceAllCmd, 2, 2, ErrMissingPattern, nil}
+	commands["replaceall"] = &Command{"replaceall", replaceAllCmd, 2, 3, ErrMissingPattern, nil}
 	commands["repall"] = commands["replaceall"]
 	commands["goto"] = &Command{"goto", goToCmd, 1, 2, ErrMissingLine, nil}
+	commands["replaceinfiles"] = &Command{"replaceinfiles", replaceInFilesCmd, 3, 4, ErrMissingPattern, GetAutocompleteFile}
+	commands["grep"] = &Command{"grep", grepCmd, 1, 3, ErrMissingPattern, GetAutocompleteFile}
+	commands["setfileformat"] = &Command{"setfileformat", setFileFormatCmd, 1, 1, ErrFileFormatArgument, GetAutocompleteFileFormat}
+	commands["setff"] = commands["setfileformat"]
+	commands["setencoding"] = &Command{"setencoding", setEncodingCmd, 1, 1, ErrEncodingArgument, GetAutocompleteEncoding}
+	commands["setenc"] = commands["setencoding"]
+	commands["mksession"] = &Command{"mksession", mkSessionCmd, 0, 1, nil, GetAutocompleteFile}
+	commands["loadsession"] = &Command{"loadsession", loadSessionCmd, 0, 1, nil, GetAutocompleteFile}
+	commands["theme"] = &Command{"theme", themeCmd, 1, 1, ErrMissingThemeName, GetAutocompleteTheme}
+	commands["set"] = &Command{"set", setCmd, 2, math.MaxInt32, ErrMissingOption, GetAutocompleteOption}
+	commands["setlocal"] = &Command{"setlocal", setLocalCmd, 2, math.MaxInt32, ErrMissingOption, GetAutocompleteLocalOption}
+	commands["reloadconfig"] = &Command{"reloadconfig", reloadConfigCmd, 0, 0, nil, nil}
 }
 
 func quitCmd(g *gocui.Gui, cmd []string) error {
@@ -58,33 +89,50 @@ func closeCmd(g *gocui.Gui, cmd []string) error {
 func saveAndQuit(g *gocui.Gui, cmd []string) error {
 	// vMain, _ := g.View("main")
 	vMain := g.Workingview()
-	if vMain.Title == "" && len(cmd) == 1 {
+	if filePath(vMain) == "" && len(cmd) == 1 {
 		return ErrMissingFilename
 	}
-	if vMain.Title == "" {
-		vMain.Title = cmd[1]
+	if filePath(vMain) == "" {
+		setFilePath(vMain, cmd[1])
 	}
-	createFile(vMain.Title)
-	if err := saveMain(vMain, vMain.Title); err != nil {
+	createFile(filePath(vMain))
+	if err := saveMain(vMain, filePath(vMain)); err != nil {
 		return err
 	}
 	return quit(g, vMain)
 }
 
 func replaceAllCmd(g *gocui.Gui, cmd []string) error {
-	replaceAll(g, cmd[1], cmd[2])
+	args := cmd[1:]
+	opts, flagged := parseSearchFlags(args[0], defaultSearchOptions())
+	if flagged {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return ErrMissingPattern
+	}
+	if len(args) > 2 {
+		return ErrUnexpectedArgument
+	}
+	re, err := compileSearch(args[0], opts)
+	if err != nil {
+		return err
+	}
+	replaceAll(g.Workingview(), re, opts, args[1])
 	return nil
 }
 
 func saveAndClose(g *gocui.Gui, cmd []string) error {
 	// vMain, _ := g.View("main")
 	vMain := g.Workingview()
-	if vMain.Title != "" || len(cmd) > 1 {
-		if vMain.Title == "" {
+	if filePath(vMain) != "" || len(cmd) > 1 {
+		if filePath(vMain) == "" {
 			createFile(cmd[1])
-			vMain.Title = cmd[1]
+			setFilePath(vMain, cmd[1])
+		}
+		if err := saveMain(vMain, filePath(vMain)); err != nil {
+			return err
 		}
-		saveMain(vMain, vMain.Title)
 		closeView(g, vMain)
 		return nil
 	}
@@ -93,12 +141,20 @@ func saveAndClose(g *gocui.Gui, cmd []string) error {
 
 func openCmd(g *gocui.Gui, cmd []string) error {
 	openAndDisplayFile(g, cmd[1])
+	if _, err := os.Stat(swapPath(cmd[1])); err == nil {
+		// the answer is given in the inputline
+		doSwitchMode(g, editMode)
+		currentDemonInput = offerRecovery(g, g.Workingview())
+	}
 	return nil
 }
 
+func viewCmd(g *gocui.Gui, cmd []string) error {
+	return viewFile(g, cmd[1])
+}
+
 func saveAsCmd(g *gocui.Gui, cmd []string) error {
-	saveAs(g, cmd[1])
-	return nil
+	return saveAs(g, cmd[1])
 }
 
 func setWrapCmd(g *gocui.Gui, cmd []string) error {
@@ -126,6 +182,23 @@ func goToCmd(g *gocui.Gui, cmd []string) error {
 			return ErrNumberExpected
 		}
 	}
+	if err := goTo(g, x, y); err != nil {
+		return err
+	}
+	switchModeHandlerFactory(editMode)(g, vMain)
+	return nil
+}
+
+// goTo moves the cursor of the working view to the column x of the line y
+func goTo(g *gocui.Gui, x, y int) error {
+	vMain := g.Workingview()
+	// in large file mode, the lines around y are loaded first
+	if lf, ok := largeFiles[vMain.Name()]; ok {
+		if err := loadLargeWindow(vMain, lf, y); err != nil {
+			return err
+		}
+		y -= lf.first
+	}
 	vMain.SetOrigin(0, 0)
 	vMain.SetCursor(0, 0)
 	_, cy := vMain.Cursor()
@@ -141,6 +214,5 @@ func goToCmd(g *gocui.Gui, cmd []string) error {
 	}
 	vMain.MoveCursor(x, 0, false)
 	vMain.Actions.Cut()
-	switchModeHandlerFactory(editMode)(g, vMain)
 	return nil
 }
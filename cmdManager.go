@@ -216,3 +216,21 @@ func intersectionString(s1, s2 string) string {
 	}
 	return output
 }
+
+// autocompleteWord returns the longest completion of the prefix common to
+// the words beginning by it
+func autocompleteWord(prefix string, words []string) string {
+	output := ""
+	firstWord := true
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			if !firstWord {
+				output = intersectionString(output, w)
+			} else {
+				output = w
+				firstWord = false
+			}
+		}
+	}
+	return output
+}
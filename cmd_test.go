@@ -66,7 +66,7 @@ func TestCloseCmd(t *testing.T) {
 	vMain := g.Workingview()
 	writeInView(v, "c!")
 	validateCmd(g, v)
-	assert.Equal(t, "", vMain.Title, "Title of the main view should be empty")
+	assert.Equal(t, "", filePath(vMain), "Title of the main view should be empty")
 	assert.Equal(t, "", vMain.Buffer(), "The buffer of the main view should be empty")
 
 	//TODO : add an error when there is an unexpected argument
@@ -97,6 +97,16 @@ func TestReplaceAllCmd(t *testing.T) {
 	writeInView(v, "repall 1 2 3")
 	validateCmd(g, v)
 	assert.Contains(t, vError.Buffer(), ErrUnexpectedArgument.Error(), "unexpected third argument")
+
+	//regexp mode without replacement
+	writeInView(v, "repall -r foo")
+	validateCmd(g, v)
+	assert.Contains(t, vError.Buffer(), ErrMissingPattern.Error(), "missing replacement for regexp search/replace")
+
+	//regexp mode with an invalid pattern
+	writeInView(v, "repall -r foo( bar")
+	validateCmd(g, v)
+	assert.Contains(t, vError.Buffer(), "Invalid regular expression", "invalid regexp error expected")
 }
 
 func TestSetWrapCmd(t *testing.T) {
@@ -140,7 +150,7 @@ func TestQuitAndSaveCmd(t *testing.T) {
 	// vMain, _ := g.View("main")
 	vMain := g.Workingview()
 	writeInView(v, "qs")
-	vMain.Title = "6u8Y73wHm5QWmgRPcXk96y39cL.txt"
+	setFilePath(vMain, "6u8Y73wHm5QWmgRPcXk96y39cL.txt")
 
 }
 
@@ -185,7 +195,7 @@ func TestSaveAndCloseCmd(t *testing.T) {
 	// vMain, _ := g.View("main")
 	vMain := g.Workingview()
 	vError, _ := g.View("error")
-	vMain.Title = ""
+	setFilePath(vMain, "")
 	text := "This is a \n test on two lines"
 	filename := "r9w92W2Cn7MTtAhuCP5si2LH356r8FrjV.txt"
 	//save with no current file
@@ -198,7 +208,7 @@ func TestSaveAndCloseCmd(t *testing.T) {
 
 	//save with a current file
 	vMain = g.Workingview()
-	vMain.Title = filename
+	setFilePath(vMain, filename)
 	text = "I'm trying to save \n and close an opened file"
 	writeInView(vMain, text)
 	writeInView(v, "sc")
@@ -209,7 +219,7 @@ func TestSaveAndCloseCmd(t *testing.T) {
 	os.Remove(filename)
 
 	//try to save without a current file name and without an argument
-	vMain.Title = ""
+	setFilePath(vMain, "")
 	writeInView(v, "sc")
 	validateCmd(g, v)
 	assert.Contains(t, vError.Buffer(), ErrMissingFilename.Error(), "missing filename error")
@@ -233,7 +243,7 @@ func TestSaveAndQuitCmd(t *testing.T) {
 	os.Remove(filename)
 
 	//try to save without a current file name and without an argument
-	vMain.Title = ""
+	setFilePath(vMain, "")
 	writeInView(v, "sq")
 	validateCmd(g, v)
 	assert.Contains(t, vError.Buffer(), ErrMissingFilename.Error(), "missing filename error ")
@@ -255,7 +265,7 @@ func TestGoToCmd(t *testing.T) {
 	//viewlines == nil --> moveDown does nothing
 	cx, _ := vMain.Cursor()
 	//cx, cy := vMain.Cursor()
-	//assert.Equal(t, 10, cy, "the y coordonate of the cursor should be 10 "+vMain.Title)
+	//assert.Equal(t, 10, cy, "the y coordonate of the cursor should be 10 "+filePath(vMain))
 	assert.Equal(t, 10, cx, "the x coordonate of the cursor should be 10")
 
 	v.SetCursor(0, 0)
@@ -266,7 +276,7 @@ func TestGoToCmd(t *testing.T) {
 	cx, _ = v.Cursor()
 	//cx, cy = v.Cursor()
 	//viewlines == nil --> moveDown does nothing
-	//assert.Equal(t, cy, 40, "the y coordonate of the cursor should be 10 "+vMain.Title)
+	//assert.Equal(t, cy, 40, "the y coordonate of the cursor should be 10 "+filePath(vMain))
 	assert.Equal(t, cx, 0, "the x coordonate of the cursor should be 10")
 
 	//invalide parameter
@@ -284,9 +294,14 @@ func TestGoToCmd(t *testing.T) {
 	assert.Contains(t, vError.Buffer(), ErrGoToInWrapMode.Error(), "wrap is not allowed with goto")
 }
 
+// writeInView types the string in the view, through its editor like gocui
 func writeInView(v *gocui.View, s string) {
 	for _, c := range s {
-		v.EditWrite(c)
+		if v.Editor != nil {
+			v.Editor.Edit(v, 0, c, gocui.ModNone)
+		} else {
+			v.EditWrite(c)
+		}
 	}
 }
 
@@ -2,73 +2,525 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"os/user"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/stretto-editor/gocui"
 )
 
 type config struct {
-	Wrap        bool
-	Cursor      bool
-	Guibgcolor  string
-	Guifgcolor  string
-	Viewbgcolor string
-	Viewfgcolor string
-	Selbgcolor  string
-	Selfgcolor  string
-	Highlight   bool
+	// colors of the interface
+	theme
+	Wrap      bool
+	Cursor    bool
+	Highlight bool
+	// default options of the searches
+	Ignorecase bool
+	Smartcase  bool
+	Wholeword  bool
+	// files and directories skipped by grep (shell patterns)
+	Grepignore []string
+	// seconds between two writes of the swap files, negative to disable them
+	Swapinterval int
+	// keep the previous version of a saved file in file~
+	Backup bool
+	// size in MB from which files are opened in large file mode, negative
+	// to disable it
+	Largefilesize int
+	// command writing its standard input in the file given in argument,
+	// used to save the files the user is not allowed to write
+	Privilegedwrite []string
+	// list the opened files in a tab bar at the top of the screen
+	Tabbar bool
+	// number of files whose last position is remembered, negative to
+	// disable it
+	Positions int
+	// theme replacing the colors of the configuration, in the themes
+	// directory
+	Theme string
+	// number of spaces of a tab, inserted by the tab key if expandtab
+	Tabwidth  int
+	Expandtab bool
+	// remove the spaces at the end of the lines and end the file by a
+	// newline when it is saved
+	Trimtrailingspace bool
+	Finalnewline      bool
+	// settings of the files of a language (go, json, markdown, shell,
+	// yaml), an extension (.c) or a file name (Makefile)
+	Filetypes map[string]fileTypeSettings
 }
 
 var userconfig config
 
+// ErrUnknownOption raised when a key is not an option of the configuration
+var ErrUnknownOption = errors.New("unknown option")
+
+// ErrUntrustedOption raised when a project configuration, or the one given
+// by --config, sets an option which runs a command
+var ErrUntrustedOption = errors.New("only the system and user configurations may set privilegedwrite")
+
+// themedViews are the views whose colors may be set in viewcolors
+var themedViews = []string{"infoline", "error", "cmdline", "inputline", "historic", tabbarViewName}
+
+// systemConfigFile is the configuration shared by all the users
+var systemConfigFile = "/etc/stretto/config.json"
+
+// xdgConfigDir returns the stretto directory of the XDG configuration
+// directory, or an empty string
+func xdgConfigDir() string {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		usr, err := user.Current()
+		if err != nil {
+			return ""
+		}
+		xdg = filepath.Join(usr.HomeDir, ".config")
+	}
+	return filepath.Join(xdg, "stretto")
+}
+
+// userConfigFiles returns the configuration files of the user : the one of
+// the XDG configuration directory and ~/.stretto.json
+func userConfigFiles() []string {
+	var files []string
+	if dir := xdgConfigDir(); dir != "" {
+		files = append(files, filepath.Join(dir, "config.json"))
+	}
+	usr, err := user.Current()
+	if err == nil {
+		files = append(files, filepath.Join(usr.HomeDir, ".stretto.json"))
+	}
+	return files
+}
+
+// projectConfigFile returns the .stretto.json of the directory or of its
+// nearest parent, the one of the user excepted, or an empty string
+func projectConfigFile(dir string, userFiles []string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		f := filepath.Join(dir, ".stretto.json")
+		if _, err := os.Stat(f); err == nil && !containsString(userFiles, f) {
+			return f
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// configFiles returns the configuration files, from the least to the most
+// important : the system one, the ones of the user, the one of the project
+// of the directory and the one given by --config
+func configFiles(dir string) []string {
+	userFiles := userConfigFiles()
+	files := append([]string{systemConfigFile}, userFiles...)
+	if project := projectConfigFile(dir, userFiles); project != "" {
+		files = append(files, project)
+	}
+	if *configFlag != "" {
+		files = append(files, *configFlag)
+	}
+	return files
+}
+
+// projectDir returns the directory of the file of the working view, where
+// the project configuration is looked for
+func projectDir(g *gocui.Gui) string {
+	if v := g.Workingview(); v != nil && filePath(v) != "" {
+		return filepath.Dir(filePath(v))
+	}
+	return "."
+}
+
+// readConfigs merges the configuration files in order, the options of a
+// file replacing the ones of the previous files. The files which do not
+// exist are skipped, the errors of the others are returned together.
+func readConfigs(files []string) (config, error) {
+	var c config
+	var errs []string
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil && isTrustedConfig(f) {
+			err = mergeConfig(&c, data)
+		} else if err == nil {
+			err = mergeUntrustedConfig(&c, data)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s : %v", f, err))
+		}
+	}
+	if len(errs) > 0 {
+		return c, errors.New(strings.Join(errs, " ; "))
+	}
+	return c, nil
+}
+
 func initConfig(g *gocui.Gui) {
-	usr, _ := user.Current()
-	file, e := ioutil.ReadFile(filepath.Join(usr.HomeDir, ".stretto.json"))
+	c, err := readConfigs(configFiles(projectDir(g)))
+	setConfig(g, c)
+	if err != nil {
+		displayError(g, err)
+	}
+}
+
+// mergeConfig sets the options of the JSON data in the configuration. The
+// options which are valid are kept even if others are not : the error
+// tells about the unknown keys and the bad values.
+func mergeConfig(c *config, data []byte) error {
+	var layer config
+	if err := json.Unmarshal(data, &layer); err != nil {
+		if _, syntax := err.(*json.SyntaxError); !syntax {
+			json.Unmarshal(data, c)
+		}
+		return err
+	}
+	json.Unmarshal(data, c)
+	var keys map[string]json.RawMessage
+	json.Unmarshal(data, &keys)
+	for k := range keys {
+		if !isConfigKey(k) {
+			return fmt.Errorf("%v : %s", ErrUnknownOption, k)
+		}
+	}
+	return layer.validate()
+}
+
+// isTrustedConfig returns true for the system and user configuration files,
+// which may set the options running commands
+func isTrustedConfig(file string) bool {
+	return file == systemConfigFile || containsString(userConfigFiles(), file)
+}
+
+// mergeUntrustedConfig merges the configuration like mergeConfig, except
+// privilegedwrite which is refused
+func mergeUntrustedConfig(c *config, data []byte) error {
+	saved := append([]string(nil), c.Privilegedwrite...)
+	err := mergeConfig(c, data)
+	var keys map[string]json.RawMessage
+	json.Unmarshal(data, &keys)
+	for k := range keys {
+		if strings.ToLower(k) == "privilegedwrite" {
+			c.Privilegedwrite = saved
+			if err != nil {
+				return fmt.Errorf("%v ; %v", ErrUntrustedOption, err)
+			}
+			return ErrUntrustedOption
+		}
+	}
+	return err
+}
+
+// validate checks the colors and the keys of the maps of the configuration
+func (c config) validate() error {
+	for _, color := range c.theme.colors() {
+		if _, err := parseColor(color); err != nil {
+			return err
+		}
+	}
+	for class := range c.Syntaxcolors {
+		if _, ok := defaultSyntaxColors[class]; !ok {
+			return fmt.Errorf("unknown syntax class : %s", class)
+		}
+	}
+	for name := range c.Viewcolors {
+		if !containsString(themedViews, name) {
+			return fmt.Errorf("no colors for the view : %s", name)
+		}
+	}
+	if c.Tabwidth < 0 {
+		return fmt.Errorf("bad tab width : %d", c.Tabwidth)
+	}
+	for name, t := range c.Filetypes {
+		if t.Tabwidth < 0 {
+			return fmt.Errorf("bad tab width for %s : %d", name, t.Tabwidth)
+		}
+	}
+	return nil
+}
 
-	if e != nil {
-		fmt.Printf("File error: %v\n", e)
-		return
+// configKeys returns the keys of the options of the configuration
+func configKeys() []string {
+	var keys []string
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.Anonymous {
+				add(f.Type)
+			} else {
+				keys = append(keys, strings.ToLower(f.Name))
+			}
+		}
 	}
-	json.Unmarshal(file, &userconfig)
+	add(reflect.TypeOf(config{}))
+	sort.Strings(keys)
+	return keys
+}
+
+// configField returns the field of the configuration whose key is given,
+// looking into the embedded structures like configKeys
+func configField(c reflect.Value, key string) reflect.Value {
+	for i := 0; i < c.NumField(); i++ {
+		if f := c.Type().Field(i); f.Anonymous {
+			if v := configField(c.Field(i), key); v.IsValid() {
+				return v
+			}
+		} else if strings.ToLower(f.Name) == key {
+			return c.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+func isConfigKey(key string) bool {
+	return containsString(configKeys(), strings.ToLower(key))
+}
 
-	c, _ := g.ViewNode("main")
-	v := c.LastView()
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
 
-	v.Wrap = userconfig.Wrap
-	v.Highlight = userconfig.Highlight
-	v.BgColor = setColor(userconfig.Viewbgcolor)
-	v.FgColor = setColor(userconfig.Viewfgcolor)
-	v.SelBgColor = setColor(userconfig.Selbgcolor)
-	v.SelFgColor = setColor(userconfig.Selfgcolor)
-	v.Highlight = userconfig.Highlight
+// setConfig replaces the configuration and applies it to the gui and to
+// all the views
+func setConfig(g *gocui.Gui, c config) {
+	userconfig = c
+	configTheme = c.theme.copy()
+	if c.Theme != "" {
+		if err := loadTheme(c.Theme); err != nil {
+			displayError(g, err)
+		}
+	}
+	applyConfig(g, nil)
+}
 
+// applyConfig applies the configuration to the gui and to all the views.
+// The views keep their own settings and highlight unless these options
+// changed from the old configuration, nil to apply all the options.
+func applyConfig(g *gocui.Gui, old *config) {
+	for _, name := range fileViewNames() {
+		v, err := g.View(name)
+		if err != nil {
+			continue
+		}
+		if old == nil || old.fileSettingsChanged() {
+			applyFileSettings(v, viewLabel(v))
+		}
+		if old == nil || old.Highlight != userconfig.Highlight {
+			v.Highlight = userconfig.Highlight
+			requiredViewsInfo[name].hl = userconfig.Highlight
+		}
+	}
 	g.Cursor = userconfig.Cursor
-	g.BgColor = setColor(userconfig.Guibgcolor)
-	g.FgColor = setColor(userconfig.Guifgcolor)
+	applyColors(g)
+	tabbarStale = true
+	overlayState = nil
+}
+
+// fileSettingsChanged returns true if the settings of the files differ in
+// the configuration
+func (c config) fileSettingsChanged() bool {
+	return c.Wrap != userconfig.Wrap || c.Tabwidth != userconfig.Tabwidth ||
+		c.Expandtab != userconfig.Expandtab ||
+		c.Trimtrailingspace != userconfig.Trimtrailingspace ||
+		c.Finalnewline != userconfig.Finalnewline ||
+		!reflect.DeepEqual(c.Filetypes, userconfig.Filetypes)
+}
+
+// decodeOption sets the option of the configuration. The value is read as
+// JSON, or as a string if it is not valid JSON of the type of the option.
+// Only the field of the option is decoded, so that the value cannot set
+// other options.
+func decodeOption(c *config, key, value string) error {
+	if !isConfigKey(key) {
+		return fmt.Errorf("%v : %s", ErrUnknownOption, key)
+	}
+	f := configField(reflect.ValueOf(c).Elem(), key)
+	v := reflect.New(f.Type())
+	v.Elem().Set(f)
+	if json.Unmarshal([]byte(value), v.Interface()) != nil {
+		quoted, _ := json.Marshal(value)
+		v.Elem().Set(f)
+		if json.Unmarshal(quoted, v.Interface()) != nil {
+			return fmt.Errorf("bad value for %s : %s", key, value)
+		}
+	}
+	f.Set(v.Elem())
+	return nil
+}
+
+// setCmd changes an option of the configuration for all the views, e.g.
+// set tabbar true
+func setCmd(g *gocui.Gui, cmd []string) error {
+	key, value := strings.ToLower(cmd[1]), strings.Join(cmd[2:], " ")
+	c := userconfig
+	c.theme = userconfig.theme.copy()
+	c.Filetypes = map[string]fileTypeSettings{}
+	for name, t := range userconfig.Filetypes {
+		c.Filetypes[name] = t
+	}
+	if err := decodeOption(&c, key, value); err != nil {
+		return err
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if key == "theme" {
+		if err := loadTheme(c.Theme); err != nil {
+			return err
+		}
+		c.theme = userconfig.theme
+	}
+	old := userconfig
+	userconfig = c
+	applyConfig(g, &old)
+	return nil
 }
 
+func boolOption(set func(v *gocui.View, b bool)) func(v *gocui.View, value string) error {
+	return func(v *gocui.View, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err == nil {
+			set(v, b)
+		}
+		return err
+	}
+}
+
+func colorOption(set func(v *gocui.View, a gocui.Attribute)) func(v *gocui.View, value string) error {
+	return func(v *gocui.View, value string) error {
+		a, err := parseColor(value)
+		if err == nil {
+			set(v, a)
+		}
+		return err
+	}
+}
+
+// localOptions are the options which may be set for the working view only,
+// by setlocal. The view is kept as it is if the value is not valid.
+var localOptions = map[string]func(v *gocui.View, value string) error{
+	"wrap":              boolOption(func(v *gocui.View, b bool) { v.Wrap = b }),
+	"highlight":         boolOption(func(v *gocui.View, b bool) { v.Highlight = b }),
+	"viewbgcolor":       colorOption(func(v *gocui.View, a gocui.Attribute) { v.BgColor = a }),
+	"viewfgcolor":       colorOption(func(v *gocui.View, a gocui.Attribute) { v.FgColor = a }),
+	"selbgcolor":        colorOption(func(v *gocui.View, a gocui.Attribute) { v.SelBgColor = a }),
+	"selfgcolor":        colorOption(func(v *gocui.View, a gocui.Attribute) { v.SelFgColor = a }),
+	"tabwidth":          tabwidthOption,
+	"expandtab":         boolSetting(func(s *fileSettings, b bool) { s.expandtab = b }),
+	"trimtrailingspace": boolSetting(func(s *fileSettings, b bool) { s.trimtrailingspace = b }),
+	"finalnewline":      boolSetting(func(s *fileSettings, b bool) { s.finalnewline = b }),
+}
+
+// setLocalCmd changes an option for the working view only, e.g.
+// setlocal wrap false
+func setLocalCmd(g *gocui.Gui, cmd []string) error {
+	key, value := strings.ToLower(cmd[1]), strings.Join(cmd[2:], " ")
+	set, ok := localOptions[key]
+	if !ok {
+		return fmt.Errorf("%v for the view : %s", ErrUnknownOption, key)
+	}
+	if err := set(g.Workingview(), value); err != nil {
+		return fmt.Errorf("bad value for %s : %s", key, value)
+	}
+	return nil
+}
+
+// reloadConfigCmd reads the configuration files again
+func reloadConfigCmd(g *gocui.Gui, cmd []string) error {
+	c, err := readConfigs(configFiles(projectDir(g)))
+	setConfig(g, c)
+	return err
+}
+
+// GetAutocompleteOption returns the option beginning by the prefix in
+// argument
+func GetAutocompleteOption(prefix string, posArg int) string {
+	if posArg != 1 {
+		return ""
+	}
+	return autocompleteWord(prefix, configKeys())
+}
+
+// GetAutocompleteLocalOption returns the option of the views beginning by
+// the prefix in argument
+func GetAutocompleteLocalOption(prefix string, posArg int) string {
+	if posArg != 1 {
+		return ""
+	}
+	var keys []string
+	for k := range localOptions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return autocompleteWord(prefix, keys)
+}
+
+// setColor returns the attribute of the color, the default color if it is
+// not valid
 func setColor(s string) gocui.Attribute {
-	switch s {
-	case "black":
-		return gocui.ColorBlack
-	case "red":
-		return gocui.ColorRed
-	case "green":
-		return gocui.ColorGreen
-	case "yellow":
-		return gocui.ColorYellow
-	case "blue":
-		return gocui.ColorBlue
-	case "magenta":
-		return gocui.ColorMagenta
-	case "cyan":
-		return gocui.ColorCyan
-	case "white":
-		return gocui.ColorWhite
-	default:
-		return gocui.ColorDefault
+	a, _ := parseColor(s)
+	return a
+}
 
+// parseColor returns the attribute of a color : a color name or a number
+// of the 256 colors, with bold, underline or reverse modifiers, e.g.
+// "bold 208"
+func parseColor(s string) (gocui.Attribute, error) {
+	color, attrs := gocui.ColorDefault, gocui.Attribute(0)
+	for _, f := range strings.Fields(strings.ToLower(s)) {
+		switch f {
+		case "default":
+			color = gocui.ColorDefault
+		case "black":
+			color = gocui.ColorBlack
+		case "red":
+			color = gocui.ColorRed
+		case "green":
+			color = gocui.ColorGreen
+		case "yellow":
+			color = gocui.ColorYellow
+		case "blue":
+			color = gocui.ColorBlue
+		case "magenta":
+			color = gocui.ColorMagenta
+		case "cyan":
+			color = gocui.ColorCyan
+		case "white":
+			color = gocui.ColorWhite
+		case "bold":
+			attrs |= gocui.AttrBold
+		case "underline":
+			attrs |= gocui.AttrUnderline
+		case "reverse":
+			attrs |= gocui.AttrReverse
+		default:
+			n, err := strconv.Atoi(f)
+			if err != nil || n < 0 || n > 255 {
+				return gocui.ColorDefault, fmt.Errorf("unknown color : %q", s)
+			}
+			// the colors of the 256 colors output mode start at 1
+			color = gocui.Attribute(n + 1)
+		}
 	}
+	return color | attrs, nil
 }
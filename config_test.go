@@ -3,8 +3,10 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
 	"testing"
 
 	"github.com/jroimartin/gocui"
@@ -87,3 +89,150 @@ func TestNoConfig(t *testing.T) {
 		os.Rename(copyPath, configPath)
 	}
 }
+
+func TestMergeConfig(t *testing.T) {
+	var c config
+	err := mergeConfig(&c, []byte(`{"wrap" : true, "swapinterval" : 10}`))
+	assert.Nil(t, err, "No error should be found")
+	assert.True(t, c.Wrap)
+	assert.Equal(t, 10, c.Swapinterval)
+
+	err = mergeConfig(&c, []byte(`{"swapinterval" : 3, "wrapp" : false}`))
+	assert.NotNil(t, err, "the unknown key should be reported")
+	assert.Contains(t, err.Error(), "wrapp")
+	assert.Equal(t, 3, c.Swapinterval, "the valid options should be kept")
+	assert.True(t, c.Wrap, "the options of the previous files should be kept")
+
+	err = mergeConfig(&c, []byte(`{"selbgcolor" : "purple", "backup" : true}`))
+	assert.NotNil(t, err, "the bad color should be reported")
+	assert.True(t, c.Backup, "the valid options should be kept")
+
+	assert.NotNil(t, mergeConfig(&c, []byte(`{"wrap" : "yes"}`)), "the bad value should be reported")
+	assert.NotNil(t, mergeConfig(&c, []byte(`{"wrap" : `)), "the syntax error should be reported")
+	assert.NotNil(t, mergeConfig(&c, []byte(`{"viewcolors" : {"foo" : {"bgcolor" : "red"}}}`)),
+		"the unknown view should be reported")
+}
+
+func TestLayeredConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	project := filepath.Join(dir, "project")
+	sub := filepath.Join(project, "src", "pkg")
+	os.MkdirAll(sub, 0755)
+
+	system := filepath.Join(dir, "system.json")
+	ioutil.WriteFile(system, []byte(`{"wrap" : true, "swapinterval" : 10, "syntaxcolors" : {"keyword" : "red"}}`), 0644)
+	ioutil.WriteFile(filepath.Join(project, ".stretto.json"),
+		[]byte(`{"swapinterval" : 20, "syntaxcolors" : {"comment" : "green"}}`), 0644)
+	defer func(f string) { systemConfigFile = f }(systemConfigFile)
+	systemConfigFile = system
+
+	files := configFiles(sub)
+	assert.Equal(t, system, files[0])
+	assert.Equal(t, filepath.Join(project, ".stretto.json"), files[len(files)-1],
+		"the project configuration should be found in the parent directories")
+
+	c, err := readConfigs([]string{system, filepath.Join(dir, "none.json"), files[len(files)-1]})
+	assert.Nil(t, err, "the missing files should be skipped")
+	assert.True(t, c.Wrap)
+	assert.Equal(t, 20, c.Swapinterval, "the project configuration should come last")
+	assert.Equal(t, map[string]string{"keyword": "red", "comment": "green"}, c.Syntaxcolors)
+
+	ioutil.WriteFile(system, []byte(`{"wrap" : `), 0644)
+	_, err = readConfigs([]string{system})
+	assert.Contains(t, err.Error(), system, "the file of the error should be given")
+}
+
+func TestUntrustedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	defer func(f string) { systemConfigFile = f }(systemConfigFile)
+	systemConfigFile = filepath.Join(dir, "system.json")
+	project := filepath.Join(dir, ".stretto.json")
+
+	ioutil.WriteFile(systemConfigFile, []byte(`{"privilegedwrite" : ["doas", "tee"]}`), 0644)
+	ioutil.WriteFile(project, []byte(`{"swapinterval" : 7, "PrivilegedWrite" : ["sh", "-c", "true"]}`), 0644)
+	c, err := readConfigs([]string{systemConfigFile, project})
+	assert.NotNil(t, err, "privilegedwrite should be refused in a project")
+	assert.Contains(t, err.Error(), project)
+	assert.Equal(t, []string{"doas", "tee"}, c.Privilegedwrite, "the system command should be kept")
+	assert.Equal(t, 7, c.Swapinterval, "the other options of the project should be kept")
+
+	c, err = readConfigs([]string{systemConfigFile})
+	assert.Nil(t, err, "privilegedwrite should be accepted in the system configuration")
+	assert.Equal(t, []string{"doas", "tee"}, c.Privilegedwrite)
+}
+
+func TestSetCmd(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+	saved := userconfig
+	defer func() { userconfig = saved }()
+	userconfig.Wrap = true
+
+	v := g.Workingview()
+	v.Wrap = true
+	err := setCmd(g, []string{"set", "swapinterval", "12"})
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, 12, userconfig.Swapinterval)
+	assert.True(t, v.Wrap, "the wrap of the view should be kept")
+
+	err = setCmd(g, []string{"set", "Guibgcolor", "bold", "208"})
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, "bold 208", userconfig.Guibgcolor)
+	assert.Equal(t, setColor("bold 208"), g.BgColor, "the colors should be applied")
+
+	err = setCmd(g, []string{"set", "wrap", "false"})
+	assert.Nil(t, err, "No error should be found")
+	assert.False(t, v.Wrap, "the wrap should be applied to the views")
+
+	err = setCmd(g, []string{"set", "grepignore", `[".git","*.o"]`})
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, []string{".git", "*.o"}, userconfig.Grepignore)
+
+	assert.NotNil(t, setCmd(g, []string{"set", "foo", "1"}), "the option should be unknown")
+	assert.NotNil(t, setCmd(g, []string{"set", "backup", "maybe"}), "the value should be refused")
+	selfgcolor := userconfig.Selfgcolor
+	assert.NotNil(t, setCmd(g, []string{"set", "selfgcolor", "purple"}), "the color should be refused")
+	assert.Equal(t, selfgcolor, userconfig.Selfgcolor, "the configuration should be kept")
+
+	assert.Equal(t, "swapinterval", GetAutocompleteOption("swa", 1))
+}
+
+func TestSetCmdOneOption(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+	saved := userconfig
+	defer func() { userconfig = saved }()
+	userconfig.Privilegedwrite = nil
+
+	err := setCmd(g, []string{"set", "swapinterval", `1, "privilegedwrite": ["sh", "-c", "true"]`})
+	assert.NotNil(t, err, "the value should be refused")
+	assert.Nil(t, userconfig.Privilegedwrite, "the other option should not be set")
+	assert.Equal(t, saved.Swapinterval, userconfig.Swapinterval)
+
+	err = setCmd(g, []string{"set", "guifgcolor", `red", "privilegedwrite": ["sh"], "x": "`})
+	assert.NotNil(t, err, "the value should be read as a color")
+	assert.Nil(t, userconfig.Privilegedwrite, "the other option should not be set")
+}
+
+func TestSetLocalCmd(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	v := g.Workingview()
+	v.Wrap = true
+	err := setLocalCmd(g, []string{"setlocal", "wrap", "false"})
+	assert.Nil(t, err, "No error should be found")
+	assert.False(t, v.Wrap)
+
+	err = setLocalCmd(g, []string{"setlocal", "viewbgcolor", "17"})
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, setColor("17"), v.BgColor)
+
+	assert.NotNil(t, setLocalCmd(g, []string{"setlocal", "wrap", "maybe"}))
+	assert.False(t, v.Wrap, "the view should be kept")
+	assert.NotNil(t, setLocalCmd(g, []string{"setlocal", "swapinterval", "3"}), "the option is not local")
+}
@@ -0,0 +1,64 @@
+package main
+
+import "github.com/stretto-editor/gocui"
+
+// dirtyViews are the file views modified since they were opened or saved.
+// The flag is set by the edits of the buffer, undo and redo.
+var dirtyViews = map[string]bool{}
+
+// fileEditor edits the file views like gocui, and tells about the keys
+// which modify the buffer
+var fileEditor = gocui.EditorFunc(func(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	_, y := absCursor(v)
+	gocui.DefaultEditor.Edit(v, key, ch, mod)
+	if !editKey(key, ch, mod) {
+		return
+	}
+	// deleting backward at the beginning of a line modifies the line above
+	if _, after := absCursor(v); after < y {
+		y = after
+	}
+	bufferEdited(v, y)
+})
+
+// editKey returns true for the keys modifying the buffer in the editor
+func editKey(key gocui.Key, ch rune, mod gocui.Modifier) bool {
+	switch {
+	case ch != 0 && mod == gocui.ModNone:
+		return true
+	case key == gocui.KeySpace, key == gocui.KeyEnter, key == gocui.KeyDelete,
+		key == gocui.KeyBackspace, key == gocui.KeyBackspace2:
+		return true
+	}
+	return false
+}
+
+// bufferEdited is called after each modification of the buffer of the file
+// view from the line y : the file is marked as modified, its highlights are
+// computed again from the line and the panes showing it are synchronized
+func bufferEdited(v *gocui.View, y int) {
+	setDirty(v, true)
+	highlightsEdited(v, y)
+	linkedEdited(v)
+}
+
+// historyEdited is called after undo and redo, which may give back the
+// content of the file when it was saved
+func historyEdited(v *gocui.View) {
+	// the lines modified are not known
+	bufferEdited(v, 0)
+	h, ok := savedHashes[v.Name()]
+	setDirty(v, ok && h != contentHash(v))
+}
+
+// setDirty sets the modification flag of the file, in all the panes
+// showing it
+func setDirty(v *gocui.View, dirty bool) {
+	if dirtyViews[v.Name()] != dirty {
+		tabbarStale = true
+	}
+	for _, name := range linkedViews(v.Name()) {
+		dirtyViews[name] = dirty
+	}
+	refreshTitle(v)
+}
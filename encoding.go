@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/stretto-editor/gocui"
+)
+
+const (
+	encUTF8    = "utf-8"
+	encUTF8BOM = "utf-8-bom"
+	encUTF16LE = "utf-16le"
+	encUTF16BE = "utf-16be"
+	// the utf-16 files without byte order mark
+	encUTF16LENoBOM = "utf-16le-nobom"
+	encUTF16BENoBOM = "utf-16be-nobom"
+	encLatin1       = "latin1"
+)
+
+var encodings = []string{encUTF8, encUTF8BOM, encUTF16LE, encUTF16BE, encUTF16LENoBOM, encUTF16BENoBOM, encLatin1}
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+var (
+	// ErrFileFormatArgument raised when the argument of setfileformat is not unix or dos
+	ErrFileFormatArgument = errors.New("expected unix or dos argument")
+	// ErrEncodingArgument raised when the argument of setencoding is not a known encoding
+	ErrEncodingArgument = errors.New("expected " + strings.Join(encodings, ", ") + " argument")
+	// ErrMixedLineEndings raised when saving a file whose lines end with LF
+	// and CRLF before its line endings are chosen
+	ErrMixedLineEndings = errors.New("the file has mixed line endings, choose them with setfileformat unix or dos")
+	// ErrOddUTF16 raised when opening an utf-16 file whose size is odd,
+	// which would lose its last byte
+	ErrOddUTF16 = errors.New("the file looks like utf-16 but its size is odd, it is not supported")
+)
+
+// fileFormat describes how the content of a file is stored on disk
+type fileFormat struct {
+	encoding string
+	dos      bool // lines end with CRLF
+	mixed    bool // lines end with LF and CRLF, the file is not saved
+}
+
+func (f fileFormat) String() string {
+	if f.mixed {
+		return f.encoding + " mixed"
+	}
+	if f.dos {
+		return f.encoding + " dos"
+	}
+	return f.encoding + " unix"
+}
+
+var defaultFileFormat = fileFormat{encoding: encUTF8}
+
+// fileFormats gives the format of the file of each file view
+var fileFormats = map[string]fileFormat{}
+
+func formatOf(v *gocui.View) fileFormat {
+	if f, ok := fileFormats[sourceOf(v.Name())]; ok {
+		return f
+	}
+	return defaultFileFormat
+}
+
+// decodeContent detects the encoding and the line endings of the content
+// and returns it as an utf-8 text with LF line endings. A file with both LF
+// and CRLF line endings is mixed, and its CRLF are replaced too.
+func decodeContent(content []byte) (string, fileFormat, error) {
+	var format fileFormat
+	var text string
+	var err error
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		format.encoding = encUTF8BOM
+		text = string(content[len(bomUTF8):])
+	case bytes.HasPrefix(content, bomUTF16LE):
+		format.encoding = encUTF16LE
+		text, err = decodeUTF16(content[len(bomUTF16LE):], false)
+	case bytes.HasPrefix(content, bomUTF16BE):
+		format.encoding = encUTF16BE
+		text, err = decodeUTF16(content[len(bomUTF16BE):], true)
+	case looksUTF16(content, false):
+		format.encoding = encUTF16LENoBOM
+		text, err = decodeUTF16(content, false)
+	case looksUTF16(content, true):
+		format.encoding = encUTF16BENoBOM
+		text, err = decodeUTF16(content, true)
+	case utf8.Valid(content):
+		format.encoding = encUTF8
+		text = string(content)
+	default:
+		format.encoding = encLatin1
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+	// the file is dos if most of its lines end with CRLF
+	if crlf := strings.Count(text, "\r\n"); crlf > 0 {
+		lf := strings.Count(text, "\n")
+		format.dos = crlf*2 >= lf
+		format.mixed = crlf < lf
+		text = strings.Replace(text, "\r\n", "\n", -1)
+	}
+	return text, format, err
+}
+
+// looksUTF16 returns true if the content without byte order mark seems to
+// be utf-16 : most of its characters are ascii ones, whose high byte is
+// NUL, and the other bytes are not NUL
+func looksUTF16(content []byte, bigEndian bool) bool {
+	if len(content) < 2 || bytes.IndexByte(content, 0) < 0 {
+		return false
+	}
+	high, low := 0, 0
+	for i, b := range content {
+		if b != 0 {
+			continue
+		}
+		if (i%2 == 0) == bigEndian {
+			high++
+		} else {
+			low++
+		}
+	}
+	return high*2 >= len(content)/2 && low*10 <= high
+}
+
+func decodeUTF16(content []byte, bigEndian bool) (string, error) {
+	if len(content)%2 != 0 {
+		return "", ErrOddUTF16
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(content[2*i])<<8 | uint16(content[2*i+1])
+		} else {
+			units[i] = uint16(content[2*i+1])<<8 | uint16(content[2*i])
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// encodeContent converts the utf-8 text with LF line endings to the format
+func encodeContent(text string, format fileFormat) ([]byte, error) {
+	if format.mixed {
+		return nil, ErrMixedLineEndings
+	}
+	if format.dos {
+		text = strings.Replace(text, "\n", "\r\n", -1)
+	}
+	switch format.encoding {
+	case encUTF8BOM:
+		return append(append([]byte{}, bomUTF8...), text...), nil
+	case encUTF16LE, encUTF16BE, encUTF16LENoBOM, encUTF16BENoBOM:
+		bigEndian := format.encoding == encUTF16BE || format.encoding == encUTF16BENoBOM
+		var out []byte
+		switch format.encoding {
+		case encUTF16LE:
+			out = append(out, bomUTF16LE...)
+		case encUTF16BE:
+			out = append(out, bomUTF16BE...)
+		}
+		for _, u := range utf16.Encode([]rune(text)) {
+			if bigEndian {
+				out = append(out, byte(u>>8), byte(u))
+			} else {
+				out = append(out, byte(u), byte(u>>8))
+			}
+		}
+		return out, nil
+	case encLatin1:
+		out := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xff {
+				return nil, fmt.Errorf("character %q cannot be encoded in latin1", r)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	}
+	return []byte(text), nil
+}
+
+// setFormat gives the format to the file of the view, in all the panes
+// showing it. Changing the format modifies the file.
+func setFormat(v *gocui.View, format fileFormat) {
+	if format != formatOf(v) {
+		setDirty(v, true)
+	}
+	fileFormats[sourceOf(v.Name())] = format
+	shareFileState(sourceOf(v.Name()))
+}
+
+func setFileFormatCmd(g *gocui.Gui, cmd []string) error {
+	v := g.Workingview()
+	format := formatOf(v)
+	switch cmd[1] {
+	case "unix":
+		format.dos = false
+	case "dos":
+		format.dos = true
+	default:
+		return ErrFileFormatArgument
+	}
+	format.mixed = false
+	setFormat(v, format)
+	return nil
+}
+
+func setEncodingCmd(g *gocui.Gui, cmd []string) error {
+	v := g.Workingview()
+	for _, e := range encodings {
+		if cmd[1] == e {
+			format := formatOf(v)
+			format.encoding = e
+			setFormat(v, format)
+			return nil
+		}
+	}
+	return ErrEncodingArgument
+}
+
+// GetAutocompleteFileFormat returns the file format beginning by the prefix in argument
+func GetAutocompleteFileFormat(prefix string, posArg int) string {
+	return autocompleteWord(prefix, []string{"unix", "dos"})
+}
+
+// GetAutocompleteEncoding returns the encoding beginning by the prefix in argument
+func GetAutocompleteEncoding(prefix string, posArg int) string {
+	return autocompleteWord(prefix, encodings)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeContent(t *testing.T) {
+	tests := []struct {
+		content []byte
+		text    string
+		format  fileFormat
+	}{
+		{[]byte("foo\nbar\n"), "foo\nbar\n", fileFormat{encUTF8, false, false}},
+		{[]byte("foo\r\nbar\r\n"), "foo\nbar\n", fileFormat{encUTF8, true, false}},
+		{[]byte("\xef\xbb\xbfé\n"), "é\n", fileFormat{encUTF8BOM, false, false}},
+		{[]byte("\xff\xfea\x00\xe9\x00\r\x00\n\x00"), "aé\n", fileFormat{encUTF16LE, true, false}},
+		{[]byte("\xfe\xff\x00a\x00\xe9"), "aé", fileFormat{encUTF16BE, false, false}},
+		{[]byte("a\x00\xe9\x00\n\x00"), "aé\n", fileFormat{encUTF16LENoBOM, false, false}},
+		{[]byte("\x00a\x00b\x00\r\x00\n"), "ab\n", fileFormat{encUTF16BENoBOM, true, false}},
+		{[]byte("caf\xe9\n"), "café\n", fileFormat{encLatin1, false, false}},
+		{[]byte("abc\x00def\n"), "abc\x00def\n", fileFormat{encUTF8, false, false}},
+	}
+	for _, test := range tests {
+		text, format, err := decodeContent(test.content)
+		assert.Nil(t, err, "No error should be found")
+		assert.Equal(t, test.text, text)
+		assert.Equal(t, test.format, format)
+
+		content, err := encodeContent(text, format)
+		assert.Nil(t, err, "No error should be found")
+		assert.Equal(t, test.content, content, "the content should be saved in its format")
+	}
+
+	_, err := encodeContent("€", fileFormat{encLatin1, false, false})
+	assert.NotNil(t, err, "€ is not a latin1 character")
+
+	_, _, err = decodeContent([]byte("\xff\xfea\x00b"))
+	assert.Equal(t, ErrOddUTF16, err, "the last byte should not be lost")
+	_, _, err = decodeContent([]byte("a\x00b\x00c"))
+	assert.Equal(t, ErrOddUTF16, err, "the last byte should not be lost")
+}
+
+func TestKeepFileFormat(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "dos.txt")
+	ioutil.WriteFile(filename, []byte("caf\xe9\r\nbar"), 0644)
+
+	err = openAndDisplayFile(g, filename)
+	assert.Nil(t, err, "No error should be found")
+	v := g.Workingview()
+	assert.Equal(t, "café\nbar\n", v.Buffer())
+	assert.Equal(t, "latin1 dos", formatOf(v).String())
+
+	assert.Nil(t, saveMain(v, filename), "No error should be found")
+	content, _ := ioutil.ReadFile(filename)
+	assert.Equal(t, "caf\xe9\r\nbar", string(content))
+
+	assert.Equal(t, ErrFileFormatArgument, setFileFormatCmd(g, []string{"setfileformat", "mac"}))
+	assert.Nil(t, setFileFormatCmd(g, []string{"setfileformat", "unix"}))
+	assert.True(t, isDirty(v), "changing the format should modify the file")
+	assert.Nil(t, setEncodingCmd(g, []string{"setencoding", "utf-8"}))
+	assert.Nil(t, saveMain(v, filename), "No error should be found")
+	content, _ = ioutil.ReadFile(filename)
+	assert.Equal(t, "café\nbar", string(content))
+
+	assert.Equal(t, ErrEncodingArgument, setEncodingCmd(g, []string{"setencoding", "ascii"}))
+	assert.Equal(t, "utf-16", GetAutocompleteEncoding("utf-1", 1))
+	assert.Equal(t, "dos", GetAutocompleteFileFormat("d", 1))
+}
+
+func TestMixedLineEndings(t *testing.T) {
+	text, format, _ := decodeContent([]byte("a\r\nb\nc\r\n"))
+	assert.Equal(t, "a\nb\nc\n", text)
+	assert.True(t, format.dos, "most of the lines end with CRLF")
+	assert.True(t, format.mixed)
+	assert.Equal(t, "utf-8 mixed", format.String())
+	_, err := encodeContent(text, format)
+	assert.Equal(t, ErrMixedLineEndings, err, "the line endings should not be changed")
+
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "mixed.txt")
+	ioutil.WriteFile(filename, []byte("a\r\nb\n"), 0644)
+	assert.Nil(t, openAndDisplayFile(g, filename))
+	v := g.Workingview()
+	defer closeView(g, v)
+
+	assert.NotNil(t, saveMain(v, filename))
+	content, _ := ioutil.ReadFile(filename)
+	assert.Equal(t, "a\r\nb\n", string(content), "the file should be kept")
+
+	assert.Nil(t, setFileFormatCmd(g, []string{"setfileformat", "unix"}))
+	assert.Nil(t, saveMain(v, filename), "No error should be found")
+	content, _ = ioutil.ReadFile(filename)
+	assert.Equal(t, "a\nb\n", string(content))
+}
+
+func TestFileFormatInSplit(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "unix.txt")
+	ioutil.WriteFile(filename, []byte("a\nb"), 0644)
+	assert.Nil(t, openAndDisplayFile(g, filename))
+	v := g.Workingview()
+	defer closeView(g, v)
+	c, err := cloneView(g, v)
+	assert.Nil(t, err, "No error should be found")
+	defer closeView(g, c)
+
+	g.SetWorkingView(c.Name())
+	assert.Nil(t, setFileFormatCmd(g, []string{"setfileformat", "dos"}))
+	assert.True(t, formatOf(v).dos, "the format should be shared by the panes")
+	assert.True(t, formatOf(c).dos)
+	assert.Equal(t, isDirty(v), isDirty(c))
+
+	assert.Nil(t, saveMain(v, filename), "No error should be found")
+	content, _ := ioutil.ReadFile(filename)
+	assert.Equal(t, "a\r\nb", string(content))
+}
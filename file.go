@@ -1,14 +1,124 @@
 package main
 
 import (
-	"encoding/binary"
+	"crypto/sha1"
+	"errors"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/stretto-editor/gocui"
 )
 
+// filePaths gives the file of each file view. The title of the view shows
+// it followed by the markers of the view.
+var filePaths = map[string]string{}
+
+// filePath returns the file of the view, "" when it has no file yet
+func filePath(v *gocui.View) string {
+	return filePaths[v.Name()]
+}
+
+// setFilePath gives the file to the view and shows it in the title
+func setFilePath(v *gocui.View, filename string) {
+	filePaths[v.Name()] = filename
+	refreshTitle(v)
+}
+
+// refreshTitle shows the file of the view and its markers in the title
+func refreshTitle(v *gocui.View) {
+	v.Title = strings.TrimSpace(filePath(v) + " " + viewMarkers(v))
+}
+
+// savedHashes gives, for each file view, the hash of the content of the
+// buffer when it was last opened or saved. Undo and redo compare the
+// content with it.
+var savedHashes = map[string][sha1.Size]byte{}
+
+// markSaved records the current content of the view as unmodified
+func markSaved(v *gocui.View) {
+	savedHashes[v.Name()] = contentHash(v)
+	setDirty(v, false)
+	shareFileState(v.Name())
+}
+
+// contentHash returns the hash of the buffer and of the format it is
+// saved in, so that changing the format also modifies the file
+func contentHash(v *gocui.View) [sha1.Size]byte {
+	return sha1.Sum([]byte(formatOf(v).String() + "\n" + v.Buffer()))
+}
+
+// isDirty returns true if the buffer of the file view was modified since
+// it was opened or saved
+func isDirty(v *gocui.View) bool {
+	return dirtyViews[v.Name()]
+}
+
+// readOnlyViews gives the file views which cannot be modified
+var readOnlyViews = map[string]bool{}
+
+// ErrReadOnly raised when saving a read-only file view
+var ErrReadOnly = errors.New("the file is read-only")
+
+func isReadOnly(v *gocui.View) bool {
+	return v != nil && readOnlyViews[v.Name()]
+}
+
+func removeFileState(viewName string) {
+	delete(filePaths, viewName)
+	delete(savedHashes, viewName)
+	delete(dirtyViews, viewName)
+	delete(readOnlyViews, viewName)
+	removeBuffer(viewName)
+	delete(unwritableViews, viewName)
+	delete(largeFiles, viewName)
+	delete(fileStamps, viewName)
+	delete(fileFormats, viewName)
+	delete(viewSettings, viewName)
+	delete(staleHistories, viewName)
+	removeSwapFile(viewName)
+}
+
+// dirtyFileViews returns the file views with unsaved modifications
+func dirtyFileViews(g *gocui.Gui) []*gocui.View {
+	var views []*gocui.View
+	for _, name := range fileViewNames() {
+		if v, err := g.View(name); err == nil && isDirty(v) {
+			views = append(views, v)
+		}
+	}
+	return views
+}
+
+// viewLabel returns the name of the file of the view, or the name of the
+// view when it has no file yet
+func viewLabel(v *gocui.View) string {
+	if filePath(v) != "" {
+		return filePath(v)
+	}
+	return v.Name()
+}
+
+// dirtyMarker returns the marker shown for views with unsaved modifications
+func dirtyMarker(v *gocui.View) string {
+	if isDirty(v) {
+		return "[+]"
+	}
+	return ""
+}
+
+// refreshTitles shows the markers of the file views in their title. It is
+// called by the layout, after each event.
+func refreshTitles(g *gocui.Gui) {
+	for _, name := range fileViewNames() {
+		if v, err := g.View(name); err == nil {
+			refreshTitle(v)
+		}
+	}
+}
+
 // create the file in the directory of the
 func createFile(filename string) {
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
@@ -27,6 +137,7 @@ var newFileHandler = func() func(g *gocui.Gui, v *gocui.View) error {
 		g.SetViewOnTop(newView.Name())
 		g.SetCurrentView(newView.Name())
 		g.SetWorkingView(newView.Name())
+		refreshTabBar(g)
 		return nil
 	}
 }()
@@ -34,11 +145,13 @@ var newFileHandler = func() func(g *gocui.Gui, v *gocui.View) error {
 func saveHandler(g *gocui.Gui, v *gocui.View) error {
 	// vMain, _ := g.View("main")
 	vMain := g.Workingview()
-	if vMain.Title == "" {
+	if filePath(vMain) == "" {
 		currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
 			createFile(input)
-			vMain.Title = input
-			if err := saveMain(vMain, vMain.Title); err != nil {
+			setFilePath(vMain, input)
+			setLanguage(vMain, input)
+			applyFileSettings(vMain, input)
+			if err := saveMain(vMain, filePath(vMain)); err != nil {
 				return nil, err
 			}
 			return nil, nil
@@ -48,8 +161,14 @@ func saveHandler(g *gocui.Gui, v *gocui.View) error {
 		return nil
 	}
 
-	if err := saveMain(vMain, vMain.Title); err != nil {
-		return err
+	switch err := saveMain(vMain, filePath(vMain)); err {
+	case nil:
+	case ErrChangedOnDisk:
+		currentDemonInput = askOverwrite(g, vMain)
+	case ErrReadOnly, ErrNotWritable:
+		currentDemonInput = askSaveElsewhere(g, vMain, err == ErrNotWritable)
+	default:
+		displayError(g, err)
 	}
 	return nil
 }
@@ -58,82 +177,188 @@ func saveMain(v *gocui.View, filename string) error {
 	if filename == "" {
 		return nil
 	}
-	f, err := os.OpenFile(filename, os.O_WRONLY, 0666)
+	if _, ok := largeFiles[v.Name()]; ok {
+		return ErrLargeFileSave
+	}
+	if filename == filePath(v) && isReadOnly(v) {
+		return ErrReadOnly
+	}
+	if filename == filePath(v) && changedOnDisk(v) {
+		return ErrChangedOnDisk
+	}
+	content := fileContent(v, filename)
+	if userconfig.Backup && filename == filePath(v) {
+		if err := backupFile(filename); err != nil {
+			return fmt.Errorf("Could not backup %s : %v", filename, err)
+		}
+	}
+	data, err := encodeContent(content, formatOf(v))
 	if err != nil {
-		return err
+		return fmt.Errorf("Could not save %s : %v", filename, err)
 	}
-	defer f.Close()
-
-	p := make([]byte, 5)
-	v.Rewind()
-	var size int64 = -1
-	for {
-		n, err := v.Read(p)
-		size += int64(n)
-		if n > 0 {
-			if _, err = f.Write(p[:n]); err != nil {
-				return err
-			}
+	if err := writeFileAtomic(filename, data); os.IsPermission(err) {
+		return ErrNotWritable
+	} else if err != nil {
+		return fmt.Errorf("Could not save %s : %v", filename, err)
+	}
+	if filename == filePath(v) {
+		markSaved(v)
+		recordWritten(v, filename, data)
+		removeSwapFile(v.Name())
+	}
+	return nil
+}
+
+// writeFileAtomic writes the data in a temporary file of the same directory,
+// then renames it over the file. The permissions and the owner of the file
+// are kept. A crash during the save leaves the file untouched.
+// When the directory is not writable, or the owner cannot be kept, the file
+// is overwritten in place.
+func writeFileAtomic(filename string, data []byte) error {
+	target := filename
+	if t, err := filepath.EvalSymlinks(filename); err == nil {
+		target = t
+	}
+	mode := os.FileMode(0644)
+	fi, statErr := os.Stat(target)
+	if statErr == nil {
+		mode = fi.Mode().Perm()
+		// the rename would replace a file the user is not allowed to write
+		if !writable(target) {
+			return &os.PathError{Op: "open", Path: target, Err: os.ErrPermission}
 		}
-		if err == io.EOF {
-			f.Truncate(size * int64(binary.Size(p[0])))
-			break
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".")
+	if err != nil {
+		if statErr == nil {
+			return writeInPlace(target, data)
 		}
-		if err != nil {
-			return err
+		return err
+	}
+	abort := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		return abort(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return abort(err)
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return abort(err)
+	}
+	if statErr == nil {
+		if err = keepOwner(tmp, fi); err != nil {
+			abort(err)
+			return writeInPlace(target, data)
 		}
 	}
+	if err = tmp.Close(); err != nil {
+		return abort(err)
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// make the rename durable
+	if dir, err := os.Open(filepath.Dir(target)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
 	return nil
 }
 
-func quitHandler(g *gocui.Gui, v *gocui.View) error {
-	currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
-		if input != "n" {
-			// vMain, _ := g.View("main")
-			vMain := g.Workingview()
-			if vMain.Title == "" {
-				interactive(g, "File name")
-				return func(g *gocui.Gui, input string) (demonInput, error) {
-
-					createFile(input)
-					vMain.Title = input
-					if err := saveMain(vMain, vMain.Title); err != nil {
-						return nil, err
-					}
+// writeInPlace overwrites the content of an existing file
+func writeInPlace(filename string, data []byte) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-					return nil, gocui.ErrQuit
-				}, nil
+func quitHandler(g *gocui.Gui, v *gocui.View) error {
+	dirty := dirtyFileViews(g)
+	if len(dirty) == 0 {
+		return gocui.ErrQuit
+	}
+	currentDemonInput = askSaveAndQuit(g, dirty)
+	return nil
+}
 
-			}
-			if err := saveMain(vMain, vMain.Title); err != nil {
-				return nil, err
-			}
+// askSaveAndQuit asks whether the modifications of the first view should be
+// saved, then goes on with the next views. It quits after the last one.
+func askSaveAndQuit(g *gocui.Gui, views []*gocui.View) demonInput {
+	vMain := views[0]
+	next := func() (demonInput, error) {
+		if len(views) == 1 {
+			return nil, gocui.ErrQuit
 		}
-		return nil, gocui.ErrQuit
+		return askSaveAndQuit(g, views[1:]), nil
 	}
 
-	interactive(g, "Save Modifications (y/n)")
-	return nil
+	interactive(g, fmt.Sprintf("Save Modifications of %s (y/n)", viewLabel(vMain)))
+	return func(g *gocui.Gui, input string) (demonInput, error) {
+		if input == "n" {
+			return next()
+		}
+		if filePath(vMain) == "" {
+			interactive(g, "File name")
+			return func(g *gocui.Gui, input string) (demonInput, error) {
+				createFile(input)
+				setFilePath(vMain, input)
+				setLanguage(vMain, input)
+				applyFileSettings(vMain, input)
+				if err := saveMain(vMain, filePath(vMain)); err != nil {
+					return nil, err
+				}
+				return next()
+			}, nil
+		}
+		if err := saveMain(vMain, filePath(vMain)); err != nil {
+			return nil, err
+		}
+		return next()
+	}
 }
 
 func closeFileHandler(g *gocui.Gui, v *gocui.View) error {
+	// the buffer stays opened in the linked views
+	if !isDirty(g.Workingview()) || len(linkedViews(g.Workingview().Name())) > 1 {
+		closeView(g, g.Workingview())
+		return nil
+	}
+
 	currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
 		// vMain, _ := g.View("main")
 		vMain := g.Workingview()
 		if input != "n" {
-			if vMain.Title == "" {
+			if filePath(vMain) == "" {
 				interactive(g, "File name")
 				return func(g *gocui.Gui, input string) (demonInput, error) {
 					createFile(input)
-					vMain.Title = input
-					if err := saveMain(vMain, vMain.Title); err != nil {
+					setFilePath(vMain, input)
+					setLanguage(vMain, input)
+					applyFileSettings(vMain, input)
+					if err := saveMain(vMain, filePath(vMain)); err != nil {
 						return nil, err
 					}
 					closeView(g, vMain)
 					return nil, nil
 				}, nil
 			}
-			if err := saveMain(vMain, vMain.Title); err != nil {
+			if err := saveMain(vMain, filePath(vMain)); err != nil {
 				return nil, err
 			}
 		}
@@ -147,7 +372,10 @@ func closeFileHandler(g *gocui.Gui, v *gocui.View) error {
 
 func openFileHandler(g *gocui.Gui, v *gocui.View) error {
 	currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
-		return nil, openAndDisplayFile(g, input)
+		if err := openAndDisplayFile(g, input); err != nil {
+			return nil, err
+		}
+		return offerRecovery(g, g.Workingview()), nil
 	}
 	interactive(g, "Open File")
 	return nil
@@ -162,12 +390,38 @@ func openAndDisplayFile(g *gocui.Gui, filename string) error {
 	// g.SetViewOnTop(v.Name())
 	err := openFile(v, filename)
 	if err == nil {
-		v.Title = filename
+		setFilePath(v, filename)
+		restorePosition(v)
+		readOnlyFileMode(g)
 		return nil
 	}
 	return fmt.Errorf("Could not open file : %s", filename)
 }
 
+// openedFileView returns the file view displaying the file, or nil
+func openedFileView(g *gocui.Gui, filename string) *gocui.View {
+	for name, info := range requiredViewsInfo {
+		if _, linked := linkedTo[name]; info.c != "main" || linked {
+			continue
+		}
+		if v, err := g.View(name); err == nil && filePath(v) != "" && samePath(filePath(v), filename) {
+			return v
+		}
+	}
+	return nil
+}
+
+// samePath returns true if the paths name the same file, one being
+// relative and the other absolute for instance
+func samePath(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
 func saveAsHandler(g *gocui.Gui, v *gocui.View) error {
 	currentDemonInput = func(g *gocui.Gui, filename string) (demonInput, error) {
 		return nil, saveAs(g, filename)
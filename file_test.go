@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretto-editor/gocui"
+)
+
+func TestDirtyFlag(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	err := openAndDisplayFile(g, "LICENSE")
+	assert.Nil(t, err, "No error should be found")
+	v := g.Workingview()
+	assert.False(t, isDirty(v), "an opened file should not be modified")
+	assert.Equal(t, "", dirtyMarker(v))
+
+	writeInView(v, "foo")
+	assert.True(t, isDirty(v), "the buffer should be modified")
+	assert.Equal(t, "[+]", dirtyMarker(v))
+	assert.Equal(t, []*gocui.View{v}, dirtyFileViews(g))
+	refreshTitles(g)
+	assert.Equal(t, "LICENSE [+]", v.Title, "the marker should follow the file in the title")
+
+	// undo gives back the saved content
+	v.SetCursor(0, 0)
+	for i := 0; i < 3; i++ {
+		v.EditDelete(false)
+	}
+	undoHandler(g, v)
+	assert.False(t, isDirty(v), "the buffer should not be modified after undo")
+	assert.Equal(t, "LICENSE", v.Title)
+	closeView(g, v)
+}
+
+func TestQuitWithModifiedFiles(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		filename := filepath.Join(dir, name)
+		ioutil.WriteFile(filename, []byte("foo"), 0644)
+		assert.Nil(t, openAndDisplayFile(g, filename), "No error should be found")
+		writeInView(g.Workingview(), "x")
+	}
+	dirty := dirtyFileViews(g)
+	assert.Equal(t, 2, len(dirty), "both files should be modified")
+	defer closeView(g, dirty[0])
+	defer closeView(g, dirty[1])
+
+	// each modified file is asked for, the first one is saved
+	assert.Nil(t, quitHandler(g, g.Workingview()), "the modifications should be asked to be saved")
+	next, err := currentDemonInput(g, "y")
+	assert.Nil(t, err, "No error should be found")
+	assert.NotNil(t, next, "the second file should be asked for")
+	assert.Equal(t, "xfoo", getContentFile(filePath(dirty[0])))
+	assert.False(t, isDirty(dirty[0]), "the first file should be saved")
+
+	next, err = next(g, "n")
+	assert.Equal(t, gocui.ErrQuit, err, "quit expected after the last file")
+	assert.Nil(t, next)
+	assert.Equal(t, "foo", getContentFile(filePath(dirty[1])), "the second file should not be saved")
+	assert.True(t, isDirty(dirty[1]))
+}
+
+func TestQuitWithoutModification(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	v := g.Workingview()
+	assert.Equal(t, gocui.ErrQuit, quitHandler(g, v), "nothing to save, quit expected")
+
+	writeInView(v, "foo")
+	assert.Nil(t, quitHandler(g, v), "modifications should be asked to be saved")
+	assert.NotNil(t, currentDemonInput)
+}
+
+func TestSaveKeepsPermissions(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "r9w92W2Cn7MTtAhuCP5si2LH356r8FrjV.txt")
+	ioutil.WriteFile(filename, []byte("a longer content than the new one"), 0600)
+
+	v := g.Workingview()
+	writeInView(v, "foo")
+	err := saveMain(v, filename)
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, "foo", getContentFile(filename))
+
+	fi, _ := os.Stat(filename)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "permissions should be kept")
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files), "no temporary file should be left")
+}
+
+func TestSaveError(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	err := saveMain(g.Workingview(), "r9w92W2Cn7MTtAhuCP5si2LH356r8FrjV/unknown/dir")
+	assert.NotNil(t, err, "saving in an unknown directory should fail")
+}
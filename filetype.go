@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// defaultTabwidth is the number of spaces of a tab when it is not given in
+// the configuration
+const defaultTabwidth = 4
+
+// fileTypeSettings are the settings of the files of a language, an
+// extension or a file name. The settings which are not given are the ones
+// of the configuration.
+type fileTypeSettings struct {
+	Tabwidth          int
+	Expandtab         *bool
+	Wrap              *bool
+	Trimtrailingspace *bool
+	Finalnewline      *bool
+}
+
+// fileSettings are the settings applied to a file view
+type fileSettings struct {
+	wrap              bool
+	tabwidth          int
+	expandtab         bool
+	trimtrailingspace bool
+	finalnewline      bool
+}
+
+// viewSettings gives the settings of the file views, by view name
+var viewSettings = map[string]fileSettings{}
+
+// merge replaces the settings by the ones given for the file type
+func (s *fileSettings) merge(t fileTypeSettings) {
+	if t.Tabwidth > 0 {
+		s.tabwidth = t.Tabwidth
+	}
+	if t.Expandtab != nil {
+		s.expandtab = *t.Expandtab
+	}
+	if t.Wrap != nil {
+		s.wrap = *t.Wrap
+	}
+	if t.Trimtrailingspace != nil {
+		s.trimtrailingspace = *t.Trimtrailingspace
+	}
+	if t.Finalnewline != nil {
+		s.finalnewline = *t.Finalnewline
+	}
+}
+
+// settingsFor returns the settings of the file : the ones of the
+// configuration, replaced by the ones of its language, of its extension
+// and of its name, in this order
+func settingsFor(filename string) fileSettings {
+	s := fileSettings{
+		wrap:              userconfig.Wrap,
+		tabwidth:          userconfig.Tabwidth,
+		expandtab:         userconfig.Expandtab,
+		trimtrailingspace: userconfig.Trimtrailingspace,
+		finalnewline:      userconfig.Finalnewline,
+	}
+	if s.tabwidth <= 0 {
+		s.tabwidth = defaultTabwidth
+	}
+	if l := languageFor(filename); l != nil {
+		s.merge(userconfig.Filetypes[l.name])
+	}
+	if ext := strings.ToLower(filepath.Ext(filename)); ext != "" {
+		s.merge(userconfig.Filetypes[ext])
+	}
+	s.merge(userconfig.Filetypes[filepath.Base(filename)])
+	return s
+}
+
+// applyFileSettings gives the settings of the file to the view
+func applyFileSettings(v *gocui.View, filename string) {
+	s := settingsFor(filename)
+	viewSettings[v.Name()] = s
+	v.Wrap = s.wrap
+	if info, ok := requiredViewsInfo[v.Name()]; ok {
+		info.wr = s.wrap
+	}
+}
+
+// settingsOf returns the settings of the file view
+func settingsOf(v *gocui.View) fileSettings {
+	if s, ok := viewSettings[sourceOf(v.Name())]; ok {
+		return s
+	}
+	return settingsFor(viewLabel(v))
+}
+
+// insertTabHandler inserts a tab, or the spaces up to the next tab stop
+// when the tabs are expanded
+func insertTabHandler(g *gocui.Gui, v *gocui.View) error {
+	s := settingsOf(v)
+	x, y := absCursor(v)
+	if !s.expandtab {
+		v.EditWrite('\t')
+		bufferEdited(v, y)
+		return nil
+	}
+	for i := x % s.tabwidth; i < s.tabwidth; i++ {
+		v.EditWrite(' ')
+	}
+	bufferEdited(v, y)
+	return nil
+}
+
+// trimTrailingSpace removes the spaces and the tabs at the end of the lines
+func trimTrailingSpace(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fileContent returns the content of the view to write in the file, with
+// the trailing spaces removed and the final newline added by the settings.
+// The view is not modified.
+func fileContent(v *gocui.View, filename string) string {
+	s, ok := viewSettings[sourceOf(v.Name())]
+	if !ok {
+		s = settingsFor(filename)
+	}
+	// the buffer ends with a newline which is not part of the file
+	content := strings.TrimSuffix(v.Buffer(), "\n")
+	if s.trimtrailingspace {
+		content = trimTrailingSpace(content)
+	}
+	if s.finalnewline && content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content
+}
+
+// settingOption sets a setting of the file of the view by setlocal
+func settingOption(set func(s *fileSettings, value string) error) func(v *gocui.View, value string) error {
+	return func(v *gocui.View, value string) error {
+		s := settingsOf(v)
+		if err := set(&s, value); err != nil {
+			return err
+		}
+		viewSettings[sourceOf(v.Name())] = s
+		return nil
+	}
+}
+
+func boolSetting(set func(s *fileSettings, b bool)) func(v *gocui.View, value string) error {
+	return settingOption(func(s *fileSettings, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err == nil {
+			set(s, b)
+		}
+		return err
+	})
+}
+
+var tabwidthOption = settingOption(func(s *fileSettings, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("bad tab width : %s", value)
+	}
+	s.tabwidth = n
+	return nil
+})
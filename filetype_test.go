@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsFor(t *testing.T) {
+	old := userconfig
+	defer func() { userconfig = old }()
+	no, yes := false, true
+	userconfig.Wrap = false
+	userconfig.Tabwidth = 0
+	userconfig.Expandtab = true
+	userconfig.Filetypes = map[string]fileTypeSettings{
+		"markdown": {Wrap: &yes},
+		".mk":      {Expandtab: &no},
+		"Makefile": {Expandtab: &no, Tabwidth: 8},
+		"go":       {Expandtab: &no},
+		".go":      {Tabwidth: 2},
+	}
+
+	s := settingsFor("a/Makefile")
+	assert.False(t, s.expandtab, "Makefiles should get real tabs")
+	assert.Equal(t, 8, s.tabwidth)
+	assert.False(t, settingsFor("rules.mk").expandtab)
+
+	assert.True(t, settingsFor("README.md").wrap, "markdown should be wrapped")
+	assert.Equal(t, defaultTabwidth, settingsFor("README.md").tabwidth)
+
+	s = settingsFor("main.go")
+	assert.False(t, s.wrap)
+	assert.False(t, s.expandtab, "the settings of the language should be kept")
+	assert.Equal(t, 2, s.tabwidth, "the extension should replace the language")
+
+	assert.True(t, settingsFor("LICENSE").expandtab, "the configuration is the default")
+}
+
+func TestInsertTab(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	v := g.Workingview()
+	viewSettings[v.Name()] = fileSettings{tabwidth: 4, expandtab: true}
+	defer delete(viewSettings, v.Name())
+	v.Clear()
+	fmt.Fprint(v, "a")
+	v.SetOrigin(0, 0)
+	v.SetCursor(1, 0)
+	insertTabHandler(g, v)
+	line, _ := v.Line(0)
+	assert.Equal(t, "a   ", line, "the spaces should reach the next tab stop")
+
+	err := setLocalCmd(g, []string{"setlocal", "expandtab", "false"})
+	assert.Nil(t, err, "No error should be found")
+	insertTabHandler(g, v)
+	line, _ = v.Line(0)
+	assert.Equal(t, "a   \t", line)
+
+	assert.NotNil(t, setLocalCmd(g, []string{"setlocal", "tabwidth", "0"}))
+	assert.Equal(t, 4, settingsOf(v).tabwidth, "the tab width should be kept")
+}
+
+func TestSaveWithSettings(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "notes.txt")
+
+	v := g.Workingview()
+	viewSettings[v.Name()] = fileSettings{trimtrailingspace: true, finalnewline: true}
+	defer delete(viewSettings, v.Name())
+	v.Clear()
+	fmt.Fprint(v, "a  \nb\t")
+	err = saveMain(v, filename)
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, "a\nb\n", getContentFile(filename))
+	assert.Equal(t, "a  \nb\t\n", v.Buffer(), "the view should not be modified")
+
+	setFilePath(v, filename)
+	markSaved(v)
+	defer delete(savedHashes, v.Name())
+	v.Clear()
+	fmt.Fprint(v, "d \n")
+	bufferEdited(v, 0)
+	v.SetCursor(2, 0)
+	err = saveMain(v, filename+".bak")
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, "d\n", getContentFile(filename+".bak"))
+	assert.Equal(t, "d \n\n", v.Buffer(), "save as should not modify the view")
+	assert.True(t, isDirty(v), "save as should not mark the view saved")
+	setFilePath(v, "")
+
+	viewSettings[v.Name()] = fileSettings{}
+	v.Clear()
+	fmt.Fprint(v, "c ")
+	saveMain(v, filename)
+	assert.Equal(t, "c ", getContentFile(filename), "the content should be kept")
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/stretto-editor/gocui"
+)
+
+const grepViewName = "Grep results"
+
+// defaultGrepIgnore are the files and directories skipped by grep when
+// nothing is configured
+var defaultGrepIgnore = []string{".git", ".hg", ".svn", "node_modules", "*~"}
+
+// grepMatch is a line of a file matching the pattern
+type grepMatch struct {
+	file string
+	line int
+	col  int
+	text string
+}
+
+func grepIgnoreList() []string {
+	if userconfig.Grepignore != nil {
+		return userconfig.Grepignore
+	}
+	return defaultGrepIgnore
+}
+
+// ignored returns true if the base name of the path matches one of the
+// patterns of the ignore list
+func ignored(path string, ignore []string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range ignore {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinary guesses if the content is not text by looking for a NUL byte
+// in its beginning
+func isBinary(content []byte) bool {
+	if len(content) > 512 {
+		content = content[:512]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// grepFile appends the lines of the file matching re to matches
+func grepFile(path string, re *regexp.Regexp, matches []grepMatch) ([]grepMatch, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return matches, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	if isBinary(head[:n]) {
+		return matches, nil
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		return matches, err
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for i := 0; scanner.Scan(); i++ {
+		line := scanner.Text()
+		if loc := re.FindStringIndex(line); loc != nil {
+			matches = append(matches, grepMatch{
+				file: path,
+				line: i,
+				col:  len([]rune(line[:loc[0]])),
+				text: line,
+			})
+		}
+	}
+	return matches, scanner.Err()
+}
+
+// grepDir looks for re in all the files of the directory tree, skipping
+// the files and directories of the ignore list
+func grepDir(dir string, re *regexp.Regexp, ignore []string) ([]grepMatch, error) {
+	var matches []grepMatch
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// unreadable files are skipped
+			return nil
+		}
+		if path != dir && ignored(path, ignore) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		matches, _ = grepFile(path, re, matches)
+		return nil
+	})
+	return matches, err
+}
+
+func grepCmd(g *gocui.Gui, cmd []string) error {
+	args := cmd[1:]
+	opts, flagged := parseSearchFlags(args[0], defaultSearchOptions())
+	if flagged {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return ErrMissingPattern
+	}
+	dir := "."
+	if len(args) > 1 {
+		dir = args[1]
+	}
+	if len(args) > 2 {
+		return ErrUnexpectedArgument
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s is not a valid directory", dir)
+	}
+	re, err := compileSearch(args[0], opts)
+	if err != nil {
+		return err
+	}
+	matches, err := grepDir(dir, re, grepIgnoreList())
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("Could not find pattern \"%s\" in %s", args[0], dir)
+	}
+	return displayGrepResults(g, matches)
+}
+
+// displayGrepResults shows the matches in a tmp view. Enter opens the file
+// of the selected match.
+func displayGrepResults(g *gocui.Gui, matches []grepMatch) error {
+	doSwitchMode(g, editMode)
+	g.DeleteView(grepViewName)
+	v, err := newTmpView(g, grepViewName)
+	if err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Wrap = false
+	v.Highlight = true
+	v.SelBgColor = setColor(userconfig.Selbgcolor)
+	v.SelFgColor = setColor(userconfig.Selfgcolor)
+	for _, m := range matches {
+		fmt.Fprintf(v, "%s:%d: %s\n", m.file, m.line+1, m.text)
+	}
+	tmpSelectHandlers[grepViewName] = func(g *gocui.Gui, v *gocui.View) error {
+		i := selectedLine(v)
+		if i >= len(matches) {
+			return nil
+		}
+		quitTmpView(g, v)
+		return openAt(g, matches[i].file, matches[i].col, matches[i].line)
+	}
+	g.SetViewOnTop(v.Name())
+	g.SetCurrentView(v.Name())
+	return nil
+}
+
+// openAt opens the file, or shows the view already displaying it, and moves
+// the cursor to the given position
+func openAt(g *gocui.Gui, filename string, x, y int) error {
+	if opened := openedFileView(g, filename); opened != nil {
+		name := opened.Name()
+		if w := g.Workingview(); w != nil && sourceOf(w.Name()) == name {
+			// the pane of the working view already shows the file
+			name = w.Name()
+		}
+		if err := showBuffer(g, name); err != nil {
+			return err
+		}
+	} else if err := openAndDisplayFile(g, filename); err != nil {
+		return err
+	}
+	v := g.Workingview()
+	g.SetViewOnTop(v.Name())
+	v.AbsMoveCursor(x, y, false)
+	updateInfos(g)
+	return nil
+}
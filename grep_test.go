@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrepDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.Mkdir(filepath.Join(dir, ".git"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("foo\nbar foo\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("nothing\n  foo\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".git", "c.txt"), []byte("foo\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "d.bin"), []byte("foo\x00"), 0644)
+
+	re, _ := compileSearch("foo", searchOptions{})
+	matches, err := grepDir(dir, re, defaultGrepIgnore)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(matches), "ignored and binary files should be skipped")
+
+	assert.Equal(t, filepath.Join(dir, "a.txt"), matches[0].file)
+	assert.Equal(t, 0, matches[0].line)
+	assert.Equal(t, 1, matches[1].line)
+	assert.Equal(t, 4, matches[1].col)
+	assert.Equal(t, filepath.Join(dir, "sub", "b.txt"), matches[2].file)
+	assert.Equal(t, "  foo", matches[2].text)
+}
+
+func TestIgnored(t *testing.T) {
+	assert.True(t, ignored("a/b/.git", defaultGrepIgnore))
+	assert.True(t, ignored("main.go~", defaultGrepIgnore))
+	assert.False(t, ignored("a/.gitignore", defaultGrepIgnore))
+}
+
+func TestOpenAtOpenedFile(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "a.txt")
+	ioutil.WriteFile(filename, []byte("foo\nbar foo\n"), 0644)
+
+	assert.Nil(t, openAndDisplayFile(g, filename))
+	v := g.Workingview()
+	defer closeView(g, v)
+	writeInView(v, "x")
+	views := len(fileViewNames())
+
+	assert.Nil(t, openAt(g, filepath.Join(dir, ".", "a.txt"), 4, 1))
+	assert.Equal(t, views, len(fileViewNames()), "the file should not be opened again")
+	assert.Equal(t, v.Name(), g.Workingview().Name())
+	assert.True(t, isDirty(v), "the modifications should be kept")
+	x, y := absCursor(v)
+	assert.Equal(t, 4, x)
+	assert.Equal(t, 1, y)
+}
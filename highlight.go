@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// span is a part of a line, in bytes, drawn with specific colors
+type span struct {
+	start, end int
+	fg, bg     gocui.Attribute
+}
+
+// searchHighlights gives, for each view name, the pattern whose matches
+// are highlighted
+var searchHighlights = map[string]*regexp.Regexp{}
+
+// overlayViewName is the view drawn over the working view, holding its
+// visible lines with their colors. The file views are never written with
+// colors.
+const overlayViewName = "colors"
+
+// renderState is what the overlay displays : the lines from first to last
+// of a view after a number of edits, top being the wrapped lines of the
+// first line above the view
+type renderState struct {
+	view        string
+	edits       int
+	first, last int
+	top, ox     int
+	re          *regexp.Regexp
+}
+
+// overlayState is the last rendering of the overlay, nil when it has to be
+// drawn again
+var overlayState *renderState
+
+// editCounts counts the modifications of the views, the overlay is only
+// drawn again after an edit or a scroll
+var editCounts = map[string]int{}
+
+// forgetRender tells that the content of the view was written again, its
+// colors and its matches are computed again
+func forgetRender(viewName string) {
+	delete(matchCaches, viewName)
+	delete(syntaxCaches, viewName)
+	if overlayState != nil && overlayState.view == viewName {
+		overlayState = nil
+	}
+}
+
+// highlightsEdited is called after each modification of the buffer of the
+// view from the line y
+func highlightsEdited(v *gocui.View, y int) {
+	editCounts[v.Name()]++
+	delete(matchCaches, v.Name())
+	syntaxEdited(v, y)
+}
+
+func setSearchHighlight(v *gocui.View, re *regexp.Regexp) {
+	searchHighlights[v.Name()] = re
+}
+
+func clearSearchHighlight(v *gocui.View) {
+	delete(searchHighlights, v.Name())
+	delete(matchCaches, v.Name())
+}
+
+// removeHighlights forgets the highlights of a deleted view
+func removeHighlights(viewName string) {
+	delete(searchHighlights, viewName)
+	forgetRender(viewName)
+	delete(editCounts, viewName)
+	delete(viewLanguages, viewName)
+}
+
+// matchColors returns the colors used to highlight the search matches.
+// The selection colors are used when no dedicated color is configured.
+func matchColors() (gocui.Attribute, gocui.Attribute) {
+	fg, bg := userconfig.Matchfgcolor, userconfig.Matchbgcolor
+	if fg == "" && bg == "" {
+		fg, bg = userconfig.Selfgcolor, userconfig.Selbgcolor
+	}
+	if fg == "" && bg == "" {
+		return gocui.ColorBlack, gocui.ColorYellow
+	}
+	return setColor(fg), setColor(bg)
+}
+
+// visibleLines returns the range of the buffer lines displayed in a view of
+// width w and height h with the origin oy, and the wrapped lines of the
+// first one above the view. When the lines are wrapped, the origin counts
+// the wrapped lines.
+func visibleLines(lines []string, oy, w, h int, wrap bool) (int, int, int) {
+	if !wrap || w <= 0 {
+		return oy, oy + h - 1, 0
+	}
+	rows := func(l string) int {
+		if n := (utf8.RuneCountInString(l) + w - 1) / w; n > 1 {
+			return n
+		}
+		return 1
+	}
+	y, row := 0, 0
+	for y < len(lines) && row+rows(lines[y]) <= oy {
+		row += rows(lines[y])
+		y++
+	}
+	first, top := y, oy-row
+	last, shown := first, -top
+	for last < len(lines)-1 {
+		if shown += rows(lines[last]); shown >= h {
+			break
+		}
+		last++
+	}
+	return first, last, top
+}
+
+// searchSpans returns the spans of the matches of re in the lines from
+// first to last
+func searchSpans(lines []string, re *regexp.Regexp, first, last int) map[int][]span {
+	fg, bg := matchColors()
+	spans := map[int][]span{}
+	for y := first; y <= last && y < len(lines); y++ {
+		for _, loc := range re.FindAllStringIndex(lines[y], -1) {
+			if loc[0] < loc[1] {
+				spans[y] = append(spans[y], span{loc[0], loc[1], fg, bg})
+			}
+		}
+	}
+	return spans
+}
+
+// matchPos is the position of a match, x being expressed in runes
+type matchPos struct {
+	x, y int
+}
+
+// findMatches returns the positions of the matches of re in the lines
+func findMatches(lines []string, re *regexp.Regexp) []matchPos {
+	var matches []matchPos
+	for y, l := range lines {
+		for _, loc := range re.FindAllStringIndex(l, -1) {
+			matches = append(matches, matchPos{utf8.RuneCountInString(l[:loc[0]]), y})
+		}
+	}
+	return matches
+}
+
+// matchIndex returns the index (starting at 1) of the match under or
+// before the position (x, y), 0 if there is none
+func matchIndex(matches []matchPos, x, y int) int {
+	return sort.Search(len(matches), func(i int) bool {
+		m := matches[i]
+		return m.y > y || (m.y == y && m.x > x)
+	})
+}
+
+// countMatches returns the number of matches of re in the buffer, and the
+// index (starting at 1) of the match under or before the position (x, y)
+func countMatches(lines []string, re *regexp.Regexp, x, y int) (int, int) {
+	matches := findMatches(lines, re)
+	return matchIndex(matches, x, y), len(matches)
+}
+
+// matchCache keeps the matches found in a view for a pattern
+type matchCache struct {
+	re      *regexp.Regexp
+	matches []matchPos
+}
+
+// matchCaches gives the matches of the last count of each view, so that the
+// buffer is only searched again when the pattern changed. The edits of the
+// buffer drop them.
+var matchCaches = map[string]*matchCache{}
+
+// matchCounter returns the "current/total" counter of the highlighted
+// search of the view, or an empty string
+func matchCounter(v *gocui.View) string {
+	re, ok := searchHighlights[v.Name()]
+	if !ok {
+		return ""
+	}
+	c, ok := matchCaches[v.Name()]
+	if !ok || c.re != re {
+		c = &matchCache{re, findMatches(bufferLines(v), re)}
+		matchCaches[v.Name()] = c
+	}
+	x, y := absCursor(v)
+	return fmt.Sprintf("%d/%d", matchIndex(c.matches, x, y), len(c.matches))
+}
+
+// colorMask keeps the color of an attribute, without its modifiers
+const colorMask = 0x1ff
+
+// colorEscape returns the escape sequences drawing the following characters
+// with the given colors and the modifiers of fg. gocui only reads a color of
+// the 256 ones at the beginning of a sequence, followed by the modifiers, so
+// these colors get their own sequences.
+func colorEscape(fg, bg gocui.Attribute) string {
+	var mods []string
+	if fg&gocui.AttrBold != 0 {
+		mods = append(mods, "1")
+	}
+	if fg&gocui.AttrUnderline != 0 {
+		mods = append(mods, "4")
+	}
+	if fg&gocui.AttrReverse != 0 {
+		mods = append(mods, "7")
+	}
+	seq := append([]string{"0"}, mods...)
+	var extra string
+	if c := fg & colorMask; c > gocui.ColorWhite {
+		extra += "\x1b[" + strings.Join(append([]string{"38", "5", fmt.Sprint(c - 1)}, mods...), ";") + "m"
+	} else if c != gocui.ColorDefault {
+		seq = append(seq, fmt.Sprintf("3%d", c-1))
+	}
+	if c := bg & colorMask; c > gocui.ColorWhite {
+		extra += fmt.Sprintf("\x1b[48;5;%dm", c-1)
+	} else if c != gocui.ColorDefault {
+		seq = append(seq, fmt.Sprintf("4%d", c-1))
+	}
+	return "\x1b[" + strings.Join(seq, ";") + "m" + extra
+}
+
+// renderLine writes the line with the colors of the spans, which must be
+// sorted and must not overlap
+func renderLine(buf *bytes.Buffer, line string, spans []span) {
+	pos := 0
+	for _, s := range spans {
+		if s.start < pos {
+			continue
+		}
+		buf.WriteString(line[pos:s.start])
+		buf.WriteString(colorEscape(s.fg, s.bg))
+		buf.WriteString(line[s.start:s.end])
+		buf.WriteString(colorEscape(gocui.ColorDefault, gocui.ColorDefault))
+		pos = s.end
+	}
+	buf.WriteString(line[pos:])
+}
+
+// tmpViewOpened returns true when a temporary view is displayed over the
+// file views
+func tmpViewOpened() bool {
+	for _, info := range requiredViewsInfo {
+		if info.c == "tmp" {
+			return true
+		}
+	}
+	return false
+}
+
+// hideOverlay hides the colors of the working view
+func hideOverlay(g *gocui.Gui) {
+	if o, err := g.View(overlayViewName); err == nil {
+		o.Hidden = true
+	}
+	overlayState = nil
+}
+
+// refreshHighlights draws the syntax and the search highlights of the
+// working view, the search matches over the syntax. Only the visible lines
+// are colored, in the overlay put over the view. The overlay is not written
+// again while the view is neither modified nor scrolled.
+// It is called by the layout, after each event.
+func refreshHighlights(g *gocui.Gui) {
+	v := g.Workingview()
+	if v == nil || v.Hidden || tmpViewOpened() {
+		hideOverlay(g)
+		return
+	}
+	re := searchHighlights[v.Name()]
+	lang := languageOf(v)
+	info, ok := requiredViewsInfo[v.Name()]
+	if !ok || (re == nil && lang == nil) {
+		hideOverlay(g)
+		return
+	}
+	o, err := g.SetView(overlayViewName, "", info.x, info.y, info.x+info.w, info.y+info.h)
+	if err != nil && err != gocui.ErrUnknownView {
+		return
+	}
+	o.Frame = false
+	o.Editable = false
+	o.Hidden = false
+	o.Wrap = v.Wrap
+	o.Highlight = v.Highlight
+	o.FgColor, o.BgColor = v.FgColor, v.BgColor
+	o.SelFgColor, o.SelBgColor = v.SelFgColor, v.SelBgColor
+
+	ox, oy := v.Origin()
+	cx, cy := v.Cursor()
+	var lines []string
+	if v.Wrap {
+		lines = bufferLines(v)
+	}
+	first, last, top := visibleLines(lines, oy, info.w-1, info.h-1, v.Wrap)
+	if last >= v.BufferSize() {
+		last = v.BufferSize() - 1
+	}
+	state := &renderState{v.Name(), editCounts[v.Name()], first, last, top, ox, re}
+	if overlayState == nil || *overlayState != *state {
+		if lines == nil {
+			lines = bufferLines(v)
+		}
+		spans := syntaxSpans(v, lines, first, last)
+		if re != nil {
+			for y, s := range searchSpans(lines, re, first, last) {
+				spans[y] = overlaySpans(spans[y], s)
+			}
+		}
+		var buf bytes.Buffer
+		for y := first; y <= last && y < len(lines); y++ {
+			if y > first {
+				buf.WriteByte('\n')
+			}
+			renderLine(&buf, lines[y], spans[y])
+		}
+		o.Clear()
+		o.Write(buf.Bytes())
+		overlayState = state
+	}
+	o.SetOrigin(ox, top)
+	o.SetCursor(cx, cy)
+	g.SetViewOnTop(overlayViewName)
+}
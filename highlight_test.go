@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretto-editor/gocui"
+)
+
+func TestCountMatches(t *testing.T) {
+	lines := []string{"foo bar foo", "", "foo"}
+	re := regexp.MustCompile("foo")
+
+	current, total := countMatches(lines, re, 0, 0)
+	assert.Equal(t, 1, current)
+	assert.Equal(t, 3, total)
+
+	current, _ = countMatches(lines, re, 5, 0)
+	assert.Equal(t, 1, current, "the cursor is after the first match")
+
+	current, _ = countMatches(lines, re, 8, 0)
+	assert.Equal(t, 2, current)
+
+	current, _ = countMatches(lines, re, 0, 2)
+	assert.Equal(t, 3, current)
+
+	current, total = countMatches(lines, regexp.MustCompile("baz"), 0, 0)
+	assert.Equal(t, 0, current)
+	assert.Equal(t, 0, total)
+}
+
+func TestRenderLine(t *testing.T) {
+	var buf bytes.Buffer
+	spans := []span{{4, 7, gocui.ColorBlack, gocui.ColorYellow}}
+	renderLine(&buf, "foo bar baz", spans)
+	assert.Equal(t, "foo \x1b[0;30;43mbar\x1b[0m baz", buf.String())
+
+	buf.Reset()
+	renderLine(&buf, "foo", nil)
+	assert.Equal(t, "foo", buf.String(), "a line without span should be kept as is")
+}
+
+func TestRenderOnlyOnChange(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	openAndDisplayFile(g, "stretto.json")
+	v := g.Workingview()
+	defer closeView(g, v)
+	buffer := v.Buffer()
+	layout(g)
+	state := overlayState
+	assert.NotNil(t, state, "the colors should be drawn")
+	o, err := g.View(overlayViewName)
+	assert.Nil(t, err, "the colors should be drawn over the view")
+	assert.False(t, o.Hidden)
+	assert.Equal(t, buffer, v.Buffer(), "the view should not be written")
+
+	layout(g)
+	assert.True(t, state == overlayState, "the colors should not be drawn again")
+	v.SetCursor(3, 2)
+	layout(g)
+	assert.True(t, state == overlayState, "moving the cursor should not draw the colors again")
+	cx, cy := o.Cursor()
+	assert.Equal(t, []int{3, 2}, []int{cx, cy}, "the cursor line should be highlighted in the overlay")
+
+	v.SetCursor(0, 1)
+	writeInView(v, "x")
+	layout(g)
+	assert.False(t, state == overlayState, "the modified view should be drawn again")
+
+	state = overlayState
+	v.SetOrigin(0, 1)
+	layout(g)
+	assert.False(t, state == overlayState, "the scrolled view should be drawn again")
+	line, _ := v.Line(1)
+	first, _ := o.Line(0)
+	assert.Equal(t, line, first, "only the visible lines should be drawn")
+
+	v.Clear()
+	fmt.Fprint(v, "a\nb")
+	forgetRender(v.Name())
+	layout(g)
+	assert.Equal(t, "b\n", o.Buffer())
+
+	doSwitchMode(g, cmdMode)
+	buffersCmd(g, nil)
+	layout(g)
+	assert.True(t, o.Hidden, "the colors should not be drawn over the temporary views")
+}
+
+func TestVisibleLines(t *testing.T) {
+	lines := []string{"aaaaa", "b", "cccccccccc", "d"}
+	first, last, top := visibleLines(lines, 1, 4, 3, false)
+	assert.Equal(t, []int{1, 3, 0}, []int{first, last, top})
+
+	// "aaaaa" takes two lines of 4 characters
+	first, last, top = visibleLines(lines, 1, 4, 3, true)
+	assert.Equal(t, []int{0, 2, 1}, []int{first, last, top})
+	first, last, top = visibleLines(lines, 3, 4, 2, true)
+	assert.Equal(t, []int{2, 2, 0}, []int{first, last, top})
+	first, _, _ = visibleLines(lines, 10, 4, 2, true)
+	assert.Equal(t, len(lines), first)
+}
+
+func TestMatchCounterCache(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	v := g.Workingview()
+	v.Clear()
+	fmt.Fprint(v, "foo bar\nfoo")
+	v.SetOrigin(0, 0)
+	v.SetCursor(0, 1)
+	re := regexp.MustCompile("foo")
+	setSearchHighlight(v, re)
+	defer clearSearchHighlight(v)
+	assert.Equal(t, "2/2", matchCounter(v))
+	c := matchCaches[v.Name()]
+
+	v.SetCursor(0, 0)
+	assert.Equal(t, "1/2", matchCounter(v))
+	assert.True(t, c == matchCaches[v.Name()], "the buffer should not be searched again")
+
+	writeInView(v, "foo")
+	assert.Equal(t, "2/3", matchCounter(v), "the modified buffer should be searched again")
+
+	setSearchHighlight(v, regexp.MustCompile("bar"))
+	assert.Equal(t, "0/1", matchCounter(v), "a new pattern should be searched")
+}
@@ -30,6 +30,8 @@ elif [ "$OSTYPE" == "linux-gnu" ]; then
   cd $GOPATH/src/github.com/stretto-editor/stretto
   go install
   mv stretto.json $HOME/.stretto.json
+  mkdir -p ${XDG_CONFIG_HOME:-$HOME/.config}/stretto
+  cp -r themes ${XDG_CONFIG_HOME:-$HOME/.config}/stretto
   mv Commands.md $HOME
   mv $GOPATH/bin/stretto $HOME
   cd $HOME
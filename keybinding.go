@@ -26,6 +26,18 @@ var currentDemonInput demonInput
 // ErrViewCreated is use for interactive actions whose create a view
 var ErrViewCreated = errors.New("A view was created")
 
+// tmpSelectHandlers gives, for each tmp view name, the handler called
+// when Enter is pressed on one of its lines
+var tmpSelectHandlers = map[string]gocui.KeybindingHandler{}
+
+// tmpCloseHandlers gives, for each tmp view name, the handler called when
+// Ctrl+W (w in file mode) is pressed on one of its lines
+var tmpCloseHandlers = map[string]gocui.KeybindingHandler{}
+
+// tmpMoveHandlers gives, for each tmp view name, the handler called when
+// Ctrl+J or Ctrl+K is pressed to move one of its lines up (-1) or down (1)
+var tmpMoveHandlers = map[string]func(g *gocui.Gui, v *gocui.View, delta int) error{}
+
 func initKeybindings(g *gocui.Gui) error {
 
 	var keyBindings = []struct {
@@ -45,7 +57,7 @@ func initKeybindings(g *gocui.Gui) error {
 		{m: editMode, v: "main", k: gocui.KeyF2, h: switchModeHandlerFactory(fileMode)},
 		{m: editMode, v: "main", k: gocui.KeyCtrlQ, h: quitHandler},
 
-		{m: cmdMode, v: "cmdline", k: gocui.KeyCtrlT, h: switchModeHandlerFactory(editMode)},
+		{m: cmdMode, v: "cmdline", k: gocui.KeyCtrlT, h: leaveCmdModeHandler},
 
 		// ---------------------- MAIN SECTION ---------------------------- //
 
@@ -77,6 +89,8 @@ func initKeybindings(g *gocui.Gui) error {
 		{m: editMode, v: "main", k: gocui.KeyCtrlN, h: newFileHandler},
 		{m: fileMode, v: "main", k: 'n', h: newFileHandler},
 
+		{m: editMode, v: "main", k: gocui.KeyTab, h: insertTabHandler},
+
 		// ---------------------- USEFUL --- ------------------------------ //
 
 		{m: fileMode, v: "main", k: 'o', h: openFileHandler},
@@ -84,7 +98,20 @@ func initKeybindings(g *gocui.Gui) error {
 		{m: fileMode, v: "main", k: 's', h: saveHandler},
 		{m: fileMode, v: "main", k: 'u', h: saveAsHandler},
 		{m: fileMode, v: "main", k: 'f', h: searchHandler},
+		{m: fileMode, v: "main", k: 'r', h: searchBackwardHandler},
+		{m: fileMode, v: "main", k: gocui.KeyF5, h: searchPreviousHandler},
+		{m: fileMode, v: "main", k: gocui.KeyF6, h: searchNextHandler},
 		{m: fileMode, v: "main", k: 'd', h: dirInfoHandler},
+		{m: fileMode, v: "main", k: 'b', h: buffersHandler},
+		{m: fileMode, v: "main", k: gocui.KeyF4, h: focusPaneHandlerFactory(1)},
+		{m: editMode, v: "main", k: gocui.KeyF4, h: focusPaneHandlerFactory(1)},
+		{m: fileMode, v: "main", k: gocui.KeyF9, h: focusPaneHandlerFactory(-1)},
+		{m: editMode, v: "main", k: gocui.KeyF9, h: focusPaneHandlerFactory(-1)},
+		{m: fileMode, v: "main", k: gocui.KeyF11, h: resizePaneHandlerFactory(-0.05)},
+		{m: editMode, v: "main", k: gocui.KeyF11, h: resizePaneHandlerFactory(-0.05)},
+		{m: fileMode, v: "main", k: gocui.KeyF12, h: resizePaneHandlerFactory(0.05)},
+		{m: editMode, v: "main", k: gocui.KeyF12, h: resizePaneHandlerFactory(0.05)},
+		{m: editMode, v: "main", k: gocui.KeyCtrlB, h: buffersHandler},
 		{m: editMode, v: "main", k: gocui.KeyCtrlD, h: dirInfoHandler},
 
 		{m: editMode, v: "main", k: gocui.KeyCtrlL, h: historicHandler},
@@ -96,7 +123,11 @@ func initKeybindings(g *gocui.Gui) error {
 		{m: editMode, v: "main", k: gocui.KeyCtrlS, h: saveHandler},
 		{m: editMode, v: "main", k: gocui.KeyCtrlU, h: saveAsHandler},
 		{m: editMode, v: "main", k: gocui.KeyCtrlF, h: searchHandler},
+		{m: editMode, v: "main", k: gocui.KeyCtrlR, h: searchBackwardHandler},
+		{m: editMode, v: "main", k: gocui.KeyF5, h: searchPreviousHandler},
+		{m: editMode, v: "main", k: gocui.KeyF6, h: searchNextHandler},
 		{m: editMode, v: "main", k: gocui.KeyCtrlP, h: searchAndReplaceHandler},
+		{m: editMode, v: "main", k: gocui.KeyCtrlE, h: queryReplaceHandler},
 		{m: editMode, v: "main", k: gocui.KeyCtrlC, h: copyHandler},
 		{m: editMode, v: "main", k: gocui.KeyCtrlV, h: pasteHandler},
 		{m: editMode, v: "main", k: gocui.KeyEnter, h: breaklineHandler},
@@ -115,12 +146,20 @@ func initKeybindings(g *gocui.Gui) error {
 		{m: fileMode, v: "tmp", k: gocui.KeyPgup, h: goPgUp},
 		{m: fileMode, v: "tmp", k: gocui.KeyPgdn, h: goPgDown},
 		{m: fileMode, v: "tmp", k: gocui.KeyEsc, h: quitTmpView},
+		{m: fileMode, v: "tmp", k: gocui.KeyEnter, h: selectTmpHandler},
+		{m: fileMode, v: "tmp", k: 'w', h: closeTmpLineHandler},
+		{m: fileMode, v: "tmp", k: gocui.KeyCtrlJ, h: moveTmpLineHandlerFactory(-1)},
+		{m: fileMode, v: "tmp", k: gocui.KeyCtrlK, h: moveTmpLineHandlerFactory(1)},
 
 		{m: editMode, v: "tmp", k: gocui.KeyArrowUp, h: scrollUp},
 		{m: editMode, v: "tmp", k: gocui.KeyArrowDown, h: scrollDown},
 		{m: editMode, v: "tmp", k: gocui.KeyPgup, h: goPgUp},
 		{m: editMode, v: "tmp", k: gocui.KeyPgdn, h: goPgDown},
 		{m: editMode, v: "tmp", k: gocui.KeyEsc, h: quitTmpView},
+		{m: editMode, v: "tmp", k: gocui.KeyEnter, h: selectTmpHandler},
+		{m: editMode, v: "tmp", k: gocui.KeyCtrlW, h: closeTmpLineHandler},
+		{m: editMode, v: "tmp", k: gocui.KeyCtrlJ, h: moveTmpLineHandlerFactory(-1)},
+		{m: editMode, v: "tmp", k: gocui.KeyCtrlK, h: moveTmpLineHandlerFactory(1)},
 
 		// ---------------------- INPUT SECTION --------------------------- //
 
@@ -178,40 +217,32 @@ func historicHandler(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
-func switchBufferForward(g *gocui.Gui, v *gocui.View) error {
-	c, _ := g.ViewNode("main")
-	newView := c.RoundRobinForward()
-	if newView != nil {
-		g.SetCurrentView(newView.Name())
-		g.SetWorkingView(newView.Name())
-	}
-	return nil
-}
-
-func switchBufferBackward(g *gocui.Gui, v *gocui.View) error {
-	c, _ := g.ViewNode("main")
-	newView := c.RoundRobinBackward()
-	if newView != nil {
-		g.SetCurrentView(newView.Name())
-		g.SetWorkingView(newView.Name())
-	}
-	return nil
-}
-
 func undoHandler(g *gocui.Gui, v *gocui.View) error {
+	if staleHistories[v.Name()] {
+		displayError(g, ErrStaleHistory)
+		return nil
+	}
 	v.Actions.Undo()
+	historyEdited(v)
 	g.UpdateHistoric()
 	return nil
 }
 
 func redoHandler(g *gocui.Gui, v *gocui.View) error {
+	if staleHistories[v.Name()] {
+		displayError(g, ErrStaleHistory)
+		return nil
+	}
 	v.Actions.Redo()
+	historyEdited(v)
 	g.UpdateHistoric()
 	return nil
 }
 
 func breaklineHandler(g *gocui.Gui, v *gocui.View) error {
+	_, y := absCursor(v)
 	v.EditNewLine()
+	bufferEdited(v, y)
 	updateInfos(g)
 	return nil
 }
@@ -240,13 +271,53 @@ func docHandler(g *gocui.Gui, v *gocui.View) error {
 }
 
 func quitTmpView(g *gocui.Gui, v *gocui.View) error {
-	g.DeleteView(g.CurrentView().Name())
-	removeInfoView(g.CurrentView().Name())
+	name := g.CurrentView().Name()
+	g.DeleteView(name)
+	removeInfoView(name)
+	delete(tmpSelectHandlers, name)
+	delete(tmpCloseHandlers, name)
+	delete(tmpMoveHandlers, name)
 	g.SetCurrentView(g.Workingview().Name())
 	g.SetViewOnTop(g.Workingview().Name())
 	return nil
 }
 
+func selectTmpHandler(g *gocui.Gui, v *gocui.View) error {
+	if h, ok := tmpSelectHandlers[v.Name()]; ok {
+		if err := h(g, v); err != nil {
+			displayError(g, err)
+		}
+	}
+	return nil
+}
+
+func closeTmpLineHandler(g *gocui.Gui, v *gocui.View) error {
+	if h, ok := tmpCloseHandlers[v.Name()]; ok {
+		if err := h(g, v); err != nil {
+			displayError(g, err)
+		}
+	}
+	return nil
+}
+
+func moveTmpLineHandlerFactory(delta int) gocui.KeybindingHandler {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if h, ok := tmpMoveHandlers[v.Name()]; ok {
+			if err := h(g, v, delta); err != nil {
+				displayError(g, err)
+			}
+		}
+		return nil
+	}
+}
+
+// selectedLine returns the line of the buffer under the cursor
+func selectedLine(v *gocui.View) int {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	return cy + oy
+}
+
 func dirInfoHandler(g *gocui.Gui, v *gocui.View) error {
 	currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
 		return nil, showDirectory(g, input)
@@ -290,10 +361,18 @@ func displayDirectoryContent(v *gocui.View, files []os.FileInfo) {
 func closeView(g *gocui.Gui, v *gocui.View) {
 	//clearView(v)
 	//v.Title = ""
-	g.DeleteView(g.Workingview().Name())
-	removeInfoView(g.Workingview().Name())
+	name := g.Workingview().Name()
+	rememberPosition(g.Workingview())
+	next := closePaneOf(g, name)
+	g.DeleteView(name)
+	removeInfoView(name)
+	removeHighlights(name)
+	removeFileState(name)
 	c, _ := g.ViewNode("main")
-	activeView := c.LastView()
+	activeView := next
+	if activeView == nil {
+		activeView = c.LastView()
+	}
 	if activeView == nil {
 		activeView, _ = newFileView(g, "file")
 	}
@@ -302,6 +381,7 @@ func closeView(g *gocui.Gui, v *gocui.View) {
 		g.SetCurrentView(activeView.Name())
 		g.SetViewOnTop(activeView.Name())
 	}
+	refreshTabBar(g)
 }
 
 func clearView(v *gocui.View) {
@@ -337,11 +417,12 @@ func validateInput(g *gocui.Gui, v *gocui.View) error {
 	// (see SearchAndReplace for instance)
 	if currentDemonInput == nil {
 		hideInputLine(g)
-		updateInfos(g)
 		if err == ErrViewCreated {
+			updateInfos(g)
 			return nil
 		}
 		g.SetCurrentView(g.Workingview().Name())
+		updateInfos(g)
 	}
 	//g.SetViewOnTop(g.Workingview().Name())
 
@@ -388,6 +469,8 @@ func doEscapeInput(g *gocui.Gui, v *gocui.View) {
 
 func escapeMainHandler(g *gocui.Gui, v *gocui.View) error {
 	hideErrorView(g)
+	clearSearchHighlight(g.Workingview())
+	updateInfos(g)
 	return nil
 }
 
@@ -398,7 +481,24 @@ func switchModeHandlerFactory(modename string) gocui.KeybindingHandler {
 	}
 }
 
+// readOnlyFileMode switches to file mode when the working view is read-only
+func readOnlyFileMode(g *gocui.Gui) {
+	if isReadOnly(g.Workingview()) && g.CurrentMode().Name() == editMode {
+		doSwitchMode(g, fileMode)
+	}
+}
+
 func doSwitchMode(g *gocui.Gui, modename string) error {
+	// read-only views stay in file mode
+	if modename == editMode && isReadOnly(g.Workingview()) {
+		modename = fileMode
+	}
+	if modename == cmdMode && g.CurrentMode().Name() != cmdMode {
+		modeBeforeCmd = g.CurrentMode().Name()
+	}
+	if g.CurrentMode().Name() == cmdMode && modename != cmdMode {
+		modeAfterCmd = ""
+	}
 	g.CurrentMode().CloseMode(g)
 	if err := g.SetCurrentMode(modename); err != nil {
 		return err
@@ -417,7 +517,15 @@ func updateInfos(g *gocui.Gui) error {
 		info.Clear()
 		maxX, _ := info.Size()
 		mode := fmt.Sprintf("%s mode", g.CurrentMode().Name())
-		pos := fmt.Sprintf("%d:%d", y, x)
+		marker := viewMarkers(g.Workingview())
+		if marker != "" {
+			mode = fmt.Sprintf("%s  %s", mode, marker)
+		}
+		pos := fmt.Sprintf("%d:%d", y+lineOffset(g.Workingview()), x)
+		if counter := matchCounter(g.Workingview()); counter != "" {
+			pos = fmt.Sprintf("[%s]  %s", counter, pos)
+		}
+		pos = fmt.Sprintf("%s  %s", formatOf(g.Workingview()), pos)
 		fmt.Fprintf(info, "%s", mode)
 		fmt.Fprintf(info, "%[2]*.[2]*[1]s", pos, maxX-len(mode))
 	}
@@ -442,19 +550,29 @@ func copyHandler(g *gocui.Gui, v *gocui.View) error {
 }
 
 func pasteHandler(g *gocui.Gui, v *gocui.View) error {
+	_, y := absCursor(v)
 	if err := paste(v); err != nil {
 		displayError(g, err)
+	} else {
+		bufferEdited(v, y)
 	}
 	updateInfos(g)
 	return nil
 }
 
 func permutLinesUpHandler(g *gocui.Gui, v *gocui.View) error {
+	_, y := absCursor(v)
 	v.EditPermutLines(true)
+	if y > 0 {
+		y--
+	}
+	bufferEdited(v, y)
 	return nil
 }
 
 func permutLinesDownHandler(g *gocui.Gui, v *gocui.View) error {
+	_, y := absCursor(v)
 	v.EditPermutLines(false)
+	bufferEdited(v, y)
 	return nil
 }
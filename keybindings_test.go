@@ -3,8 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -20,6 +22,8 @@ func initGui() *gocui.Gui {
 	defaultLayout(g)
 	layout(g) // ! instead of g.SetLayout(layout)
 	os.Args = []string{"main"}
+	// the positions of the files of the user are not used
+	positionsFile = os.DevNull
 	// since we do not enter gui's mainloop in any test
 	initKeybindings(g)
 	initCommands()
@@ -246,18 +250,25 @@ func TestDoQuitHandler(t *testing.T) {
 	g := initGui()
 	defer g.Close()
 	v, _ := g.View("inputline")
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
 	// vMain, _ := g.View("main")
 	vMain := g.Workingview()
-	vMain.Title = "unknownfile"
+	setFilePath(vMain, filepath.Join(dir, "quit.txt"))
+	// only modified files are asked to be saved
+	writeInView(vMain, "foo")
 
-	// espace with an empty input
+	// save with an empty input
 	e := quitHandler(g, v)
 	assert.Nil(t, e, "No error should be found")
 
 	e = validateInput(g, v)
-	assert.Nil(t, e, "Input shoud be valid")
+	assert.EqualError(t, e, gocui.ErrQuit.Error(), "Errquit should be returned once the file is saved")
+	assert.Equal(t, "foo", getContentFile(filePath(vMain)), "the file should be saved")
 
-	vMain.Title = ""
+	setFilePath(vMain, "")
+	writeInView(vMain, "bar")
 
 	e = quitHandler(g, v)
 	assert.Nil(t, e, "No error should be found")
@@ -268,6 +279,26 @@ func TestDoQuitHandler(t *testing.T) {
 	assert.NotNil(t, e, "Input already left")
 }
 
+func TestDoQuitWithoutSaving(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+	v, _ := g.View("inputline")
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	vMain := g.Workingview()
+	setFilePath(vMain, filepath.Join(dir, "quit.txt"))
+	writeInView(vMain, "foo")
+
+	e := quitHandler(g, v)
+	assert.Nil(t, e, "No error should be found")
+	v.EditWrite('n')
+	e = validateInput(g, v)
+	assert.EqualError(t, e, gocui.ErrQuit.Error(), "Errquit should be returned when the file is not saved")
+	_, err = os.Stat(filePath(vMain))
+	assert.True(t, os.IsNotExist(err), "the file should not be saved")
+}
+
 func TestDoCopy(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		return
@@ -334,18 +365,21 @@ func TestDoOpenHandler(t *testing.T) {
 	openFileHandler(g, v)
 	v.EditWrite('a')
 	validateInput(g, v)
+	writeInView(g.Workingview(), "foo")
 	closeFileHandler(g, v)
 	v.EditWrite('y')
 	validateInput(g, v)
 
-	vMain.Title = ""
+	setFilePath(vMain, "")
+	writeInView(g.Workingview(), "foo")
 	closeFileHandler(g, v)
 	v.EditWrite('y')
 	validateInput(g, v)
 	v.EditWrite('a')
 	validateInput(g, v)
 
-	vMain.Title = ""
+	setFilePath(vMain, "")
+	writeInView(g.Workingview(), "foo")
 	closeFileHandler(g, v)
 	v.EditWrite('n')
 	validateInput(g, v)
@@ -359,13 +393,13 @@ func TestDoSaveHandler(t *testing.T) {
 	defer g.Close()
 	// vMain, _ := g.View("main")
 	vMain := g.Workingview()
-	vMain.Title = ""
+	setFilePath(vMain, "")
 
 	v, _ := g.View("inputline")
 	saveHandler(g, v)
 	v.EditWrite('c')
 
-	vMain.Title = "c"
+	setFilePath(vMain, "c")
 	// v, _ = g.View("main")
 	v = g.Workingview()
 	v.EditWrite('k')
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// defaultLargeFileSize is the size from which a file is opened in large
+// file mode when nothing is configured
+const defaultLargeFileSize = 50 << 20
+
+// largeChunkLines is the number of lines between two indexed offsets.
+// Three chunks are loaded in the view around the cursor.
+const largeChunkLines = 1000
+
+// ErrLargeFileSave raised when saving a file opened in large file mode,
+// only a part of it is loaded in the view
+var ErrLargeFileSave = errors.New("files opened in large file mode cannot be saved")
+
+// largeFile is a file paged in a view : only the lines around the cursor
+// are loaded
+type largeFile struct {
+	path    string
+	offsets []int64 // offset of the lines 0, largeChunkLines, 2*largeChunkLines ...
+	lines   int     // number of lines of the file
+	first   int     // first line loaded in the view
+	loaded  int     // number of lines loaded in the view
+}
+
+// largeFiles gives the file paged in each view in large file mode
+var largeFiles = map[string]*largeFile{}
+
+func largeFileSize() int64 {
+	if userconfig.Largefilesize > 0 {
+		return int64(userconfig.Largefilesize) << 20
+	}
+	return defaultLargeFileSize
+}
+
+// isLargeFile returns true if the file is too big to be loaded at once
+func isLargeFile(filename string) bool {
+	if userconfig.Largefilesize < 0 {
+		return false
+	}
+	fi, err := os.Stat(filename)
+	return err == nil && fi.Mode().IsRegular() && fi.Size() >= largeFileSize()
+}
+
+// indexLargeFile reads the file once to count its lines and record the
+// offset of every largeChunkLines lines
+func indexLargeFile(filename string) (*largeFile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lf := &largeFile{path: filename, offsets: []int64{0}}
+	r := bufio.NewReaderSize(f, 1<<20)
+	var offset int64
+	for {
+		line, err := r.ReadSlice('\n')
+		offset += int64(len(line))
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			lf.lines++
+			if lf.lines%largeChunkLines == 0 {
+				lf.offsets = append(lf.offsets, offset)
+			}
+		} else if len(line) > 0 {
+			// last line without newline
+			lf.lines++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lf, nil
+}
+
+// readLines returns at most n lines of the file from the line first
+func (lf *largeFile) readLines(first, n int) ([]byte, int, error) {
+	f, err := os.Open(lf.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	chunk := first / largeChunkLines
+	if _, err := f.Seek(lf.offsets[chunk], 0); err != nil {
+		return nil, 0, err
+	}
+	r := bufio.NewReaderSize(f, 1<<20)
+	var content []byte
+	count := 0
+	for i := chunk * largeChunkLines; count < n; i++ {
+		line, err := r.ReadBytes('\n')
+		if i >= first && len(line) > 0 {
+			content = append(content, line...)
+			count++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return content, count, nil
+}
+
+// loadLargeWindow loads the lines around the line of the file in the view
+// and moves the cursor to it, keeping its position in the screen
+func loadLargeWindow(v *gocui.View, lf *largeFile, line int) error {
+	if line >= lf.lines {
+		line = lf.lines - 1
+	}
+	if line < 0 {
+		line = 0
+	}
+	first := line - largeChunkLines
+	if first < 0 {
+		first = 0
+	}
+	content, count, err := lf.readLines(first, 3*largeChunkLines)
+	if err != nil {
+		return err
+	}
+	cx, cy := v.Cursor()
+	ox, _ := v.Origin()
+	if cy > line-first {
+		cy = line - first
+	}
+	text, _, _ := decodeContent(content)
+	v.Clear()
+	fmt.Fprint(v, strings.TrimSuffix(text, "\n"))
+	forgetRender(v.Name())
+	lf.first, lf.loaded = first, count
+	v.SetOrigin(ox, line-first-cy)
+	v.SetCursor(cx, cy)
+	// the content of the view changes with the window, not with edits
+	markSaved(v)
+	return nil
+}
+
+// openLargeFile opens the file in large file mode in the view. The view
+// is read-only.
+func openLargeFile(v *gocui.View, filename string) error {
+	lf, err := indexLargeFile(filename)
+	if err != nil {
+		return err
+	}
+	setFilePath(v, filename)
+	v.SetOrigin(0, 0)
+	v.SetCursor(0, 0)
+	largeFiles[v.Name()] = lf
+	readOnlyViews[v.Name()] = true
+	v.Editable = false
+	return loadLargeWindow(v, lf, 0)
+}
+
+// lineOffset returns the line of the file displayed at the top of the
+// buffer of the view
+func lineOffset(v *gocui.View) int {
+	if lf, ok := largeFiles[v.Name()]; ok {
+		return lf.first
+	}
+	return 0
+}
+
+// followLargeFile loads other lines in the view when the cursor comes near
+// the first or the last line loaded
+func followLargeFile(v *gocui.View) error {
+	lf, ok := largeFiles[v.Name()]
+	if !ok {
+		return nil
+	}
+	_, oy := v.Origin()
+	_, cy := v.Cursor()
+	_, h := v.Size()
+	nearTop := lf.first > 0 && oy < largeChunkLines/2
+	nearBottom := lf.first+lf.loaded < lf.lines && oy+h > lf.loaded-largeChunkLines/2
+	if !nearTop && !nearBottom {
+		return nil
+	}
+	return loadLargeWindow(v, lf, lf.first+oy+cy)
+}
+
+// refreshLargeFiles is called by the layout, after each event, to follow
+// the cursor of the working view
+func refreshLargeFiles(g *gocui.Gui) {
+	if v := g.Workingview(); v != nil {
+		followLargeFile(v)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLargeFile(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "large.log")
+	f, _ := os.Create(filename)
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(f, "line %d\n", i)
+	}
+	f.Close()
+
+	userconfig.Largefilesize = 1
+	defer func() { userconfig.Largefilesize = 0 }()
+
+	lf, err := indexLargeFile(filename)
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, 100000, lf.lines)
+	assert.Equal(t, 101, len(lf.offsets), "the offset of the end of the file is also recorded")
+
+	err = openAndDisplayFile(g, filename)
+	assert.Nil(t, err, "No error should be found")
+	v := g.Workingview()
+	assert.True(t, isReadOnly(v), "large files should be read-only")
+	assert.Equal(t, fileMode, g.CurrentMode().Name())
+	assert.Equal(t, 3*largeChunkLines, v.BufferSize())
+
+	v.Wrap = false
+	err = goToCmd(g, []string{"goto", "54321"})
+	assert.Nil(t, err, "No error should be found")
+	_, oy := v.Origin()
+	_, cy := v.Cursor()
+	line, _ := v.Line(oy + cy)
+	assert.Equal(t, "line 54321", line)
+	assert.Equal(t, 54321, lineOffset(v)+oy+cy)
+	assert.Equal(t, fileMode, g.CurrentMode().Name(), "read-only views stay in file mode")
+
+	assert.Equal(t, ErrLargeFileSave, saveMain(v, filename))
+	assert.Equal(t, ErrLargeFileSave, saveMain(v, filepath.Join(dir, "copy.log")))
+}
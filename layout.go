@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -98,6 +99,10 @@ func initRequiredViewsInfo(g *gocui.Gui) {
 			hi: true,
 			up: updateHistoricView,
 		},
+		tabbarViewName: {
+			hi: true,
+			up: updateTabbarGeom,
+		},
 	}
 
 	updateGeometry(g.Size())
@@ -124,6 +129,13 @@ func updateAllLayout(g *gocui.Gui) {
 		e, _ := requiredViewsInfo["error"]
 		m.h -= e.h
 		i.y -= e.h
+	}
+	// the colors are drawn over the working view, under the other views
+	refreshHighlights(g)
+	if m := g.CurrentMode(); m != nil && m.Name() == cmdMode {
+		g.SetViewOnTop("cmdline")
+	}
+	if v, _ := g.View("error"); !v.Hidden {
 		g.SetViewOnTop("error")
 	}
 	if v, _ := g.View("inputline"); !v.Hidden {
@@ -159,27 +171,41 @@ func defaultLayout(g *gocui.Gui) error {
 		initView(g, vname)
 	}
 
-	// check if there is a second argument
-	if len(os.Args) >= 2 {
-		openAndDisplayFile(g, os.Args[1])
-	} else {
-		newFileView(g, "file")
+	// open the files given in arguments, then the files of the session
+	first, err := openArgFiles(g, parseFileArgs(flag.Args()))
+	if *sessionFlag != "" {
+		if serr := loadSession(g, *sessionFlag); serr != nil {
+			err = serr
+		}
+		if v := g.Workingview(); v != nil {
+			first = v
+		}
+	}
+	if first == nil {
+		first, _ = newFileView(g, "file")
 	}
 
 	info, _ := g.View("infoline")
+	info.Clear()
 	maxX, _ := info.Size()
 	mode := fmt.Sprintf("edit mode")
+	if isReadOnly(first) {
+		mode = fmt.Sprintf("file mode")
+	}
 	pos := fmt.Sprintf("0:0")
 	fmt.Fprintf(info, "%s", mode)
 	fmt.Fprintf(info, "%[2]*.[2]*[1]s", pos, maxX-len(mode))
 
 	// main on top
-	c, _ := g.ViewNode("main")
-	v := c.LastView()
-	if v != nil {
-		g.SetViewOnTop(v.Name())
-		g.SetCurrentView(v.Name())
-		g.SetWorkingView(v.Name())
+	g.SetViewOnTop(first.Name())
+	g.SetCurrentView(first.Name())
+	g.SetWorkingView(first.Name())
+	if *sessionFlag != "" {
+		// the mode and the position of the session
+		updateInfos(g)
+	}
+	if err != nil {
+		displayError(g, err)
 	}
 	return nil
 }
@@ -218,7 +244,11 @@ func hideErrorView(g *gocui.Gui) {
 }
 
 func layout(g *gocui.Gui) error {
+	refreshPanes(g)
 	updateAllLayout(g)
+	refreshTitles(g)
+	refreshTabBar(g)
+	refreshLargeFiles(g)
 
 	for vname, settings := range requiredViewsInfo {
 		if _, err := g.SetView(vname, settings.c, settings.x, settings.y, settings.x+settings.w, settings.y+settings.h); err != nil {
@@ -236,6 +266,16 @@ func openFile(v *gocui.View, name string) error {
 		return gocui.ErrUnknownView
 	}
 
+	if isLargeFile(name) {
+		return openLargeFile(v, name)
+	}
+
+	// the state of the file is taken before reading it, so that a change
+	// made meanwhile is detected
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
 	// get content of file
 	f, err := ioutil.ReadFile(name)
 	// inexisting file
@@ -243,11 +283,22 @@ func openFile(v *gocui.View, name string) error {
 		return err
 	}
 
-	v.Title = name
+	text, format, err := decodeContent(f)
+	if err != nil {
+		return err
+	}
+	fileFormats[v.Name()] = format
+	setLanguage(v, name)
+	applyFileSettings(v, name)
+	setFilePath(v, name)
 	v.Clear()
-	fmt.Fprintf(v, "%s", f)
+	fmt.Fprint(v, text)
+	forgetRender(v.Name())
 	v.SetOrigin(0, 0)
 	v.SetCursor(0, 0)
+	markSaved(v)
+	setStamp(v, stampOf(fi, f))
+	checkWritable(v, name)
 	return nil
 }
 
@@ -263,10 +314,7 @@ func newFileView(g *gocui.Gui, filename string) (*gocui.View, error) {
 	v, err := g.SetView(filename, "main", 0, 0, 100, 300)
 	updateFileGeom := func(maxX, maxY int) {
 		f, _ := requiredViewsInfo[filename]
-		f.w = maxX + 1
-		f.h = maxY - 1 - infoHeight
-		f.x = -1
-		f.y = 0
+		f.x, f.y, f.w, f.h = paneGeometry(filename, -1, tabbarTop(), maxX+1, maxY-1-infoHeight-tabbarTop())
 	}
 	requiredViewsInfo[filename] = &viewInfo{
 		t:       "",
@@ -280,6 +328,11 @@ func newFileView(g *gocui.Gui, filename string) (*gocui.View, error) {
 	}
 	updateFileGeom(g.Size())
 	initView(g, filename)
+	applyFileSettings(v, filename)
+	setFileViewColors(v)
+	v.Editor = fileEditor
+	addBuffer(filename)
+	markSaved(v)
 	return v, err
 }
 
@@ -6,19 +6,21 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/stretto-editor/gocui"
 )
 
+var readOnlyFlag = flag.Bool("R", false, "open the file read-only")
+var sessionFlag = flag.String("session", "", "restore the session saved in the file")
+var configFlag = flag.String("config", "", "read the configuration file after the other ones")
+
 func main() {
 	flag.Usage = usage
 	flag.Parse()
 
-	if e := createArgFileIfNotExists(); e != nil {
-		log.Panicln(e)
-	}
-
 	g := gocui.NewGui()
 	if err := g.Init(); err != nil {
 		log.Panicln(err)
@@ -38,19 +40,24 @@ func main() {
 	}
 	initCommands()
 	g.Cursor = true
-	g.SetCurrentMode(editMode)
 
 	initConfig(g)
+	restoreDelayedPositions(g)
+
+	currentDemonInput = offerRecovery(g, fileViews(g)...)
+	startTimer(g)
 
 	if err := g.MainLoop(); err != nil && err != gocui.ErrQuit {
 		g.Close()
 		log.Fatalln(err)
 	}
+	savePositions(g)
+	removeSwapFiles()
 }
 
 func usage() {
 	wiki := "Commands.md"
-	fmt.Printf("Usage : \n\t stretto [file1]\n\n\n")
+	fmt.Printf("Usage : \n\t stretto [-R] [--config file] [--session file] [+LINE] [file[:line[:col]]] ... [-]\n\n\n")
 	flag.PrintDefaults()
 	if f, err := ioutil.ReadFile(wiki); err != nil {
 		fmt.Printf("\n Cannot load the documentation. Looking for %s\n", wiki)
@@ -61,21 +68,106 @@ func usage() {
 	os.Exit(1)
 }
 
-func createArgFileIfNotExists() (err error) {
-	argsWithoutProg := os.Args[1:]
-	var filename string
-	for _, s := range argsWithoutProg {
-		if !strings.HasPrefix(s, "-") {
-			filename = s
-			break
+// fileArg is a file given on the command line, with the position where
+// the cursor is put (lines and columns start at 1, 0 if not given)
+type fileArg struct {
+	name      string
+	line, col int
+	stdin     bool
+}
+
+// positionSuffix matches the :line or :line:col at the end of file:line:col
+var positionSuffix = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?:?$`)
+
+// parseFileArgs returns the files of the command line arguments. "+LINE"
+// puts the cursor at the line of the next file, "file:line:col" opens the
+// file at the position, and "-" reads the standard input.
+func parseFileArgs(args []string) []fileArg {
+	var files []fileArg
+	line := 0
+	for _, arg := range args {
+		if n, err := strconv.Atoi(strings.TrimPrefix(arg, "+")); err == nil && strings.HasPrefix(arg, "+") {
+			line = n
+			continue
+		}
+		f := fileArg{name: arg, line: line}
+		line = 0
+		if arg == "-" {
+			f.stdin = true
+		} else if _, err := os.Stat(arg); os.IsNotExist(err) {
+			if m := positionSuffix.FindStringSubmatch(arg); m != nil {
+				f.name = m[1]
+				f.line, _ = strconv.Atoi(m[2])
+				f.col, _ = strconv.Atoi(m[3])
+			}
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// openArgFiles opens a view for each file of the command line and returns
+// the view of the first one, and the last error met. The files which do not
+// exist are created when they are saved. Their saved position is restored
+// once the configuration is read.
+func openArgFiles(g *gocui.Gui, files []fileArg) (*gocui.View, error) {
+	var first *gocui.View
+	var lastErr error
+	delayPositions = true
+	defer func() { delayPositions = false }()
+	for _, f := range files {
+		if err := openArgFile(g, f); err != nil {
+			lastErr = err
+			continue
+		}
+		if first == nil {
+			first = g.Workingview()
+		}
+	}
+	return first, lastErr
+}
+
+func openArgFile(g *gocui.Gui, f fileArg) error {
+	_, statErr := os.Stat(f.name)
+	delayed := len(delayedPositions)
+	switch {
+	case f.stdin:
+		content, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text, format, err := decodeContent(content)
+		if err != nil {
+			return err
+		}
+		v, _ := newFileView(g, "stdin")
+		fileFormats[v.Name()] = format
+		fmt.Fprint(v, text)
+		// the content read is not saved in a file yet
+		bufferEdited(v, 0)
+		g.SetWorkingView(v.Name())
+	case os.IsNotExist(statErr):
+		v, _ := newFileView(g, f.name)
+		setFilePath(v, f.name)
+		setLanguage(v, f.name)
+		g.SetWorkingView(v.Name())
+	case *readOnlyFlag:
+		if err := viewFile(g, f.name); err != nil {
+			return err
+		}
+	default:
+		if err := openAndDisplayFile(g, f.name); err != nil {
+			return err
 		}
 	}
-	if filename != "" {
-		if _, err = os.Stat(filename); os.IsNotExist(err) {
-			var file *os.File
-			file, err = os.Create(filename)
-			file.Close()
+	if f.line > 0 {
+		// the line given replaces the saved position
+		delayedPositions = delayedPositions[:delayed]
+		col := f.col - 1
+		if col < 0 {
+			col = 0
 		}
+		return goTo(g, col, f.line-1)
 	}
-	return
+	return nil
 }
@@ -1,16 +1,47 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestCreateFileInArg(t *testing.T) {
-	os.Args = []string{"main", "r9w92W2Cn7MTtAhuCP5si2LH356r8FrjV.txt"}
-	createArgFileIfNotExists()
-	_, err := os.Stat(os.Args[1])
-	assert.Equal(t, false, os.IsNotExist(err))
-	os.Remove("r9w92W2Cn7MTtAhuCP5si2LH356r8FrjV.txt")
+func TestParseFileArgs(t *testing.T) {
+	files := parseFileArgs([]string{"a.go", "+12", "LICENSE", "b.go:3:7", "c.go:5:", "-"})
+	assert.Equal(t, []fileArg{
+		{name: "a.go"},
+		{name: "LICENSE", line: 12},
+		{name: "b.go", line: 3, col: 7},
+		{name: "c.go", line: 5},
+		{name: "-", stdin: true},
+	}, files)
+}
+
+func TestOpenArgFiles(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	newFile := filepath.Join(dir, "new.txt")
+
+	first, err := openArgFiles(g, parseFileArgs([]string{"LICENSE:3:5", newFile}))
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, "LICENSE", filePath(first))
+	x, y := first.Cursor()
+	ox, oy := first.Origin()
+	assert.Equal(t, 4, x+ox)
+	assert.Equal(t, 2, y+oy)
+
+	v := g.Workingview()
+	assert.Equal(t, newFile, filePath(v))
+	_, err = os.Stat(newFile)
+	assert.True(t, os.IsNotExist(err), "the file should be created when it is saved")
+	writeInView(v, "foo")
+	assert.Nil(t, saveMain(v, filePath(v)), "No error should be found")
+	assert.Equal(t, "foo", getContentFile(newFile))
 }
@@ -6,6 +6,23 @@ const fileMode = "file"
 const editMode = "edit"
 const cmdMode = "cmd"
 
+// modeBeforeCmd is the mode from which the command mode was entered
+var modeBeforeCmd = editMode
+
+// modeAfterCmd is the mode given when leaving the command mode, the edit
+// mode when empty. A session loaded from the command mode sets its mode.
+var modeAfterCmd string
+
+// leaveCmdModeHandler switches from the command mode to modeAfterCmd
+func leaveCmdModeHandler(g *gocui.Gui, v *gocui.View) error {
+	mode := modeAfterCmd
+	if mode == "" {
+		mode = editMode
+	}
+	doSwitchMode(g, mode)
+	return nil
+}
+
 func initModes(g *gocui.Gui) {
 	openCmdMode := func(g *gocui.Gui) error {
 		g.SetWorkingView(g.CurrentView().Name())
@@ -31,7 +48,7 @@ func initModes(g *gocui.Gui) {
 	}
 	closeFileMode := func(g *gocui.Gui) error {
 		v := g.Workingview()
-		v.SetEditable(true)
+		v.SetEditable(!isReadOnly(v))
 		return nil
 	}
 	openEditMode := func(g *gocui.Gui) error {
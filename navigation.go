@@ -53,6 +53,7 @@ func goPgUp(g *gocui.Gui, v *gocui.View) error {
 			v.SetOrigin(ox, yOffset)
 			v.MoveCursor(0, 0, false)
 		}
+		followLargeFile(v)
 	}
 	updateInfos(g)
 	g.CurrentView().Actions.Cut()
@@ -75,6 +76,7 @@ func goPgDown(g *gocui.Gui, v *gocui.View) error {
 			v.SetOrigin(ox, oy+y)
 			v.MoveCursor(0, 0, false)
 		}
+		followLargeFile(v)
 	}
 	updateInfos(g)
 	g.CurrentView().Actions.Cut()
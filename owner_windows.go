@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// keepOwner does nothing : files have no unix owner on windows
+func keepOwner(f *os.File, fi os.FileInfo) error {
+	return nil
+}
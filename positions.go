@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// defaultPositions is the number of files whose position is remembered
+const defaultPositions = 500
+
+// positionsFile is the file where the positions are kept, in the home
+// directory next to the configuration file if empty
+var positionsFile = ""
+
+// filePosition is the last position of the cursor and of the origin in a
+// file, with the time when it was left
+type filePosition struct {
+	X       int   `json:"x"`
+	Y       int   `json:"y"`
+	OriginX int   `json:"originx"`
+	OriginY int   `json:"originy"`
+	Time    int64 `json:"time"`
+}
+
+// positions gives the last position in the files by absolute path, nil
+// until the positions file is read
+var positions map[string]filePosition
+
+// delayPositions is true while the files of the command line are opened :
+// the configuration is not read yet, so their position is restored later
+// by restoreDelayedPositions
+var delayPositions bool
+
+// delayedPositions are the names of the views whose position is restored
+// once the configuration is read
+var delayedPositions []string
+
+func positionsPath() string {
+	if positionsFile != "" {
+		return positionsFile
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(usr.HomeDir, ".stretto-positions.json")
+}
+
+// maxPositions returns the number of positions remembered, negative if
+// disabled in the configuration
+func maxPositions() int {
+	if userconfig.Positions == 0 {
+		return defaultPositions
+	}
+	return userconfig.Positions
+}
+
+func loadPositions() {
+	if positions != nil {
+		return
+	}
+	positions = map[string]filePosition{}
+	if data, err := ioutil.ReadFile(positionsPath()); err == nil {
+		json.Unmarshal(data, &positions)
+	}
+}
+
+// positionKey returns the key of the file of the view in the positions, or
+// false if its position is not remembered
+func positionKey(v *gocui.View) (string, bool) {
+	if maxPositions() < 0 || filePath(v) == "" {
+		return "", false
+	}
+	if _, ok := largeFiles[v.Name()]; ok {
+		return "", false
+	}
+	path, err := filepath.Abs(filePath(v))
+	return path, err == nil
+}
+
+// rememberPosition keeps the position of the cursor in the file of the view
+func rememberPosition(v *gocui.View) {
+	key, ok := positionKey(v)
+	if !ok {
+		return
+	}
+	loadPositions()
+	x, y := v.Cursor()
+	ox, oy := v.Origin()
+	positions[key] = filePosition{x, y, ox, oy, time.Now().Unix()}
+}
+
+// restorePosition puts the cursor back where it was when the file of the
+// view was left, if the line still exists
+func restorePosition(v *gocui.View) {
+	if delayPositions {
+		delayedPositions = append(delayedPositions, v.Name())
+		return
+	}
+	key, ok := positionKey(v)
+	if !ok {
+		return
+	}
+	loadPositions()
+	p, ok := positions[key]
+	if !ok || p.OriginY+p.Y >= v.BufferSize() {
+		return
+	}
+	v.SetOrigin(p.OriginX, p.OriginY)
+	v.SetCursor(p.X, p.Y)
+}
+
+// restoreDelayedPositions restores the positions of the files opened from
+// the command line, following the configuration read since
+func restoreDelayedPositions(g *gocui.Gui) {
+	for _, name := range delayedPositions {
+		if v, err := g.View(name); err == nil {
+			restorePosition(v)
+		}
+	}
+	delayedPositions = nil
+}
+
+// savePositions remembers the positions in the opened files and writes the
+// positions file, keeping the files left most recently
+func savePositions(g *gocui.Gui) error {
+	if maxPositions() < 0 {
+		return nil
+	}
+	for _, name := range fileViewNames() {
+		if v, err := g.View(name); err == nil {
+			rememberPosition(v)
+		}
+	}
+	loadPositions()
+	if len(positions) > maxPositions() {
+		keys := make([]string, 0, len(positions))
+		for k := range positions {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return positions[keys[i]].Time > positions[keys[j]].Time
+		})
+		for _, k := range keys[maxPositions():] {
+			delete(positions, k)
+		}
+	}
+	data, err := json.Marshal(positions)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(positionsPath(), data, 0644)
+}
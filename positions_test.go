@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRememberPosition(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	positionsFile = filepath.Join(dir, "positions.json")
+	positions = nil
+	defer func() { positions = nil }()
+
+	openAndDisplayFile(g, "Commands.md")
+	v := g.Workingview()
+	v.SetOrigin(0, 2)
+	v.SetCursor(4, 3)
+	closeView(g, v)
+
+	openAndDisplayFile(g, "Commands.md")
+	v = g.Workingview()
+	ox, oy := v.Origin()
+	cx, cy := v.Cursor()
+	assert.Equal(t, []int{0, 2, 4, 3}, []int{ox, oy, cx, cy}, "the position should be restored")
+
+	v.SetCursor(1, 1)
+	assert.Nil(t, savePositions(g), "No error should be found")
+	closeView(g, v)
+	positions = nil
+	openAndDisplayFile(g, "Commands.md")
+	v = g.Workingview()
+	cx, cy = v.Cursor()
+	assert.Equal(t, []int{1, 1}, []int{cx, cy}, "the positions should be read from the file")
+	closeView(g, v)
+
+	userconfig.Positions = -1
+	defer func() { userconfig.Positions = 0 }()
+	openAndDisplayFile(g, "Commands.md")
+	v = g.Workingview()
+	cx, cy = v.Cursor()
+	assert.Equal(t, []int{0, 0}, []int{cx, cy}, "the positions should not be restored when disabled")
+	closeView(g, v)
+}
+
+func TestArgFilePositions(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	positionsFile = filepath.Join(dir, "positions.json")
+	positions = nil
+	defer func() { positions = nil }()
+
+	openAndDisplayFile(g, "Commands.md")
+	v := g.Workingview()
+	v.SetCursor(2, 3)
+	closeView(g, v)
+
+	// the configuration is read after the files of the command line
+	openArgFiles(g, parseFileArgs([]string{"Commands.md"}))
+	v = g.Workingview()
+	cx, cy := v.Cursor()
+	assert.Equal(t, []int{0, 0}, []int{cx, cy}, "the position should wait for the configuration")
+	userconfig.Positions = -1
+	defer func() { userconfig.Positions = 0 }()
+	restoreDelayedPositions(g)
+	cx, cy = v.Cursor()
+	assert.Equal(t, []int{0, 0}, []int{cx, cy}, "the positions should not be restored when disabled")
+	closeView(g, v)
+
+	userconfig.Positions = 0
+	openArgFiles(g, parseFileArgs([]string{"Commands.md"}))
+	v = g.Workingview()
+	restoreDelayedPositions(g)
+	cx, cy = v.Cursor()
+	assert.Equal(t, []int{2, 3}, []int{cx, cy}, "the position should be restored")
+	closeView(g, v)
+}
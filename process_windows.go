@@ -0,0 +1,14 @@
+package main
+
+import "os"
+
+// processRunning returns true if a process with this id is running : it
+// can only be found on windows while it exists
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
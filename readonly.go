@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// ErrNotWritable raised when saving a file the user is not allowed to write
+var ErrNotWritable = errors.New("you are not allowed to write the file")
+
+// defaultPrivilegedWrite is the command writing its standard input in the
+// file given in argument with the rights of the administrator
+var defaultPrivilegedWrite = []string{"sudo", "-n", "tee"}
+
+// unwritableViews gives the file views whose file cannot be written by the
+// user
+var unwritableViews = map[string]bool{}
+
+// writable returns true if the existing file can be written by the user
+func writable(filename string) bool {
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return !os.IsPermission(err)
+	}
+	f.Close()
+	return true
+}
+
+// checkWritable records whether the file of the view can be written
+func checkWritable(v *gocui.View, filename string) {
+	if writable(filename) == unwritableViews[v.Name()] {
+		tabbarStale = true
+	}
+	if writable(filename) {
+		delete(unwritableViews, v.Name())
+	} else {
+		unwritableViews[v.Name()] = true
+	}
+}
+
+// readOnlyMarker returns the marker of the read-only views and of the
+// views whose file cannot be written
+func readOnlyMarker(v *gocui.View) string {
+	if isReadOnly(v) || unwritableViews[v.Name()] {
+		return "[RO]"
+	}
+	return ""
+}
+
+// viewMarkers returns the read-only and the modification markers of the view
+func viewMarkers(v *gocui.View) string {
+	return strings.TrimSpace(readOnlyMarker(v) + " " + dirtyMarker(v))
+}
+
+// viewFile opens the file in a read-only view, which stays in file mode
+func viewFile(g *gocui.Gui, filename string) error {
+	if err := openAndDisplayFile(g, filename); err != nil {
+		return err
+	}
+	v := g.Workingview()
+	readOnlyViews[v.Name()] = true
+	tabbarStale = true
+	v.Editable = false
+	readOnlyFileMode(g)
+	return nil
+}
+
+// askSaveElsewhere asks how to save a view which cannot be saved in its
+// file : in another file or, when the user is not allowed to write the
+// file, with the rights of the administrator
+func askSaveElsewhere(g *gocui.Gui, v *gocui.View, privileged bool) demonInput {
+	question := fmt.Sprintf("%s is read-only : save (a)s, (c)ancel", filePath(v))
+	if privileged {
+		question = fmt.Sprintf("%s is not writable : save (a)s, (p)rivileged write, (c)ancel", filePath(v))
+	}
+	var ask demonInput
+	ask = func(g *gocui.Gui, input string) (demonInput, error) {
+		switch {
+		case input == "a":
+			interactive(g, "Save as")
+			return func(g *gocui.Gui, filename string) (demonInput, error) {
+				return nil, saveAs(g, filename)
+			}, nil
+		case input == "p" && privileged:
+			return nil, privilegedWrite(v, filePath(v))
+		case input == "c":
+			return nil, nil
+		}
+		interactive(g, question)
+		return ask, nil
+	}
+	interactive(g, question)
+	return ask
+}
+
+// privilegedWrite saves the view in the file with the command configured
+// in privilegedwrite (sudo -n tee by default)
+func privilegedWrite(v *gocui.View, filename string) error {
+	content := fileContent(v, filename)
+	data, err := encodeContent(content, formatOf(v))
+	if err != nil {
+		return fmt.Errorf("Could not save %s : %v", filename, err)
+	}
+	command := userconfig.Privilegedwrite
+	if len(command) == 0 {
+		command = defaultPrivilegedWrite
+	}
+	cmd := exec.Command(command[0], append(command[1:], filename)...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.New(msg)
+		}
+		return fmt.Errorf("Could not save %s : %v", filename, err)
+	}
+	if filename == filePath(v) {
+		markSaved(v)
+		recordWritten(v, filename, data)
+		removeSwapFile(v.Name())
+	}
+	return nil
+}
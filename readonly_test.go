@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewCmd(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	err := viewCmd(g, []string{"view", "LICENSE"})
+	assert.Nil(t, err, "No error should be found")
+	v := g.Workingview()
+	assert.Equal(t, "LICENSE", filePath(v))
+	assert.True(t, isReadOnly(v), "the view should be read-only")
+	assert.False(t, v.Editable, "the view should not be editable")
+	assert.Equal(t, "[RO]", viewMarkers(v))
+	refreshTitles(g)
+	assert.Equal(t, "LICENSE [RO]", v.Title, "the marker should follow the file in the title")
+	assert.Equal(t, ErrReadOnly, saveMain(v, filePath(v)))
+
+	doSwitchMode(g, editMode)
+	assert.Equal(t, fileMode, g.CurrentMode().Name(), "read-only views stay in file mode")
+
+	saveHandler(g, v)
+	assert.NotNil(t, currentDemonInput, "saving elsewhere should be offered")
+	currentDemonInput = nil
+}
+
+func TestUnwritableFile(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "locked.txt")
+	ioutil.WriteFile(filename, []byte("foo"), 0444)
+
+	err = openAndDisplayFile(g, filename)
+	assert.Nil(t, err, "No error should be found")
+	v := g.Workingview()
+	writeInView(v, "bar")
+	if os.Geteuid() != 0 {
+		assert.Equal(t, "[RO] [+]", viewMarkers(v))
+		assert.Equal(t, ErrNotWritable, saveMain(v, filename))
+	}
+
+	userconfig.Privilegedwrite = []string{"tee"}
+	defer func() { userconfig.Privilegedwrite = nil }()
+	os.Chmod(filename, 0644)
+	assert.Nil(t, privilegedWrite(v, filename), "No error should be found")
+	content, _ := ioutil.ReadFile(filename)
+	assert.Equal(t, "barfoo", string(content))
+	assert.False(t, isDirty(v), "the file should be saved")
+}
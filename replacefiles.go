@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/stretto-editor/gocui"
+)
+
+const replacePreviewViewName = "Replace in files - Enter to apply, Esc to cancel"
+
+// ErrModifiedFiles raised when replacing in files opened with unsaved
+// modifications
+var ErrModifiedFiles = errors.New("save the modified files before replacing in them")
+
+// lineChange is a line modified by a replacement
+type lineChange struct {
+	line     int
+	old, new string
+	count    int // number of occurences replaced in the line
+}
+
+// fileReplacement holds the changes computed for a file
+type fileReplacement struct {
+	file    string
+	content string // content of the file once replaced
+	format  fileFormat
+	changes []lineChange
+}
+
+// globFiles returns the files matching the glob. A glob without directory
+// (e.g. "*.go") is matched against the files of the whole current tree.
+func globFiles(glob string) ([]string, error) {
+	if strings.Contains(glob, "/") {
+		return filepath.Glob(glob)
+	}
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return nil, err
+	}
+	ignore := grepIgnoreList()
+	var files []string
+	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != "." && ignored(path, ignore) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ok, _ := filepath.Match(glob, info.Name()); ok && info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// computeReplacement replaces the matches in the content of the file
+func computeReplacement(file string, re *regexp.Regexp, opts searchOptions, replacement string) (*fileReplacement, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	text, format, err := decodeContent(content)
+	if err != nil {
+		// like the binary files, the files which cannot be read as text
+		// are skipped
+		return nil, nil
+	}
+	return replaceText(file, text, format, re, opts, replacement), nil
+}
+
+// replaceText replaces the matches in the text of the file, nil if there is
+// none
+func replaceText(file, text string, format fileFormat, re *regexp.Regexp, opts searchOptions, replacement string) *fileReplacement {
+	if isBinary([]byte(text)) {
+		return nil
+	}
+	r := &fileReplacement{file: file, format: format}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		newline := replaceInLine(re, opts, replacement, line)
+		if newline != line {
+			r.changes = append(r.changes, lineChange{
+				line:  i,
+				old:   line,
+				new:   newline,
+				count: len(re.FindAllStringIndex(line, -1)),
+			})
+			lines[i] = newline
+		}
+	}
+	if len(r.changes) == 0 {
+		return nil
+	}
+	r.content = strings.Join(lines, "\n")
+	return r
+}
+
+// replacedView returns the view whose buffer is replaced instead of the
+// file, nil if the file is not opened or only partly loaded
+func replacedView(g *gocui.Gui, file string) *gocui.View {
+	v := openedFileView(g, file)
+	if v == nil {
+		return nil
+	}
+	if _, ok := largeFiles[v.Name()]; ok {
+		return nil
+	}
+	return v
+}
+
+// writePreview writes the changes in a diff-like format
+func writePreview(v *gocui.View, replacements []*fileReplacement) {
+	for _, r := range replacements {
+		fmt.Fprintf(v, "--- %s\n+++ %s\n", r.file, r.file)
+		for _, c := range r.changes {
+			fmt.Fprintf(v, "@@ line %d @@\n- %s\n+ %s\n", c.line+1, c.old, c.new)
+		}
+	}
+}
+
+func replaceInFilesCmd(g *gocui.Gui, cmd []string) error {
+	args := cmd[1:]
+	opts, flagged := parseSearchFlags(args[0], defaultSearchOptions())
+	if flagged {
+		args = args[1:]
+	}
+	if len(args) < 3 {
+		return ErrMissingPattern
+	}
+	if len(args) > 3 {
+		return ErrUnexpectedArgument
+	}
+	re, err := compileSearch(args[0], opts)
+	if err != nil {
+		return err
+	}
+	files, err := globFiles(args[2])
+	if err != nil {
+		return err
+	}
+	var replacements []*fileReplacement
+	var modified []string
+	for _, f := range files {
+		// the opened files are replaced as they are shown
+		var r *fileReplacement
+		if v := replacedView(g, f); v != nil {
+			r = replaceText(f, strings.TrimSuffix(v.Buffer(), "\n"), formatOf(v), re, opts, args[1])
+			if r != nil && isDirty(v) {
+				modified = append(modified, f)
+			}
+		} else if r, err = computeReplacement(f, re, opts, args[1]); err != nil {
+			return err
+		}
+		if r != nil {
+			replacements = append(replacements, r)
+		}
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("%v : %s", ErrModifiedFiles, strings.Join(modified, ", "))
+	}
+	if len(replacements) == 0 {
+		return fmt.Errorf("Could not find pattern \"%s\" in %s", args[0], args[2])
+	}
+
+	doSwitchMode(g, editMode)
+	g.DeleteView(replacePreviewViewName)
+	v, err := newTmpView(g, replacePreviewViewName)
+	if err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Wrap = false
+	writePreview(v, replacements)
+	tmpSelectHandlers[replacePreviewViewName] = func(g *gocui.Gui, v *gocui.View) error {
+		quitTmpView(g, v)
+		return applyReplacements(g, replacements, re, opts, args[1])
+	}
+	g.SetViewOnTop(v.Name())
+	g.SetCurrentView(v.Name())
+	return nil
+}
+
+// applyReplacements saves the replaced files. Files opened in a view are
+// modified in the view before being saved, unless they were modified since
+// the preview.
+func applyReplacements(g *gocui.Gui, replacements []*fileReplacement, re *regexp.Regexp, opts searchOptions, replacement string) error {
+	count := 0
+	for _, r := range replacements {
+		if v := replacedView(g, r.file); v != nil {
+			if isDirty(v) {
+				return fmt.Errorf("%v : %s", ErrModifiedFiles, r.file)
+			}
+			replaceAll(v, re, opts, replacement)
+			syncLinkedViews(g, v)
+			if err := saveMain(v, r.file); err != nil {
+				return err
+			}
+		} else if err := saveContent(g, r.file, r.content, r.format); err != nil {
+			return err
+		}
+		for _, c := range r.changes {
+			count += c.count
+		}
+	}
+	return fmt.Errorf("%d occurence(s) replaced in %d file(s)", count, len(replacements))
+}
+
+// saveContent saves the content in the file, in the given format, through
+// a hidden view
+func saveContent(g *gocui.Gui, filename, content string, format fileFormat) error {
+	name := "save " + filename
+	v, err := g.SetView(name, "tmp", 0, 0, 1, 1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	defer g.DeleteView(name)
+	fileFormats[name] = format
+	defer delete(fileFormats, name)
+	v.Hidden = true
+	v.Clear()
+	fmt.Fprint(v, content)
+	return saveMain(v, filename)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeReplacement(t *testing.T) {
+	f, _ := ioutil.TempFile("", "stretto")
+	defer os.Remove(f.Name())
+	f.WriteString("foo = 1\nbar = 2\nfoo = foo\n")
+	f.Close()
+
+	re, _ := compileSearch("foo", searchOptions{})
+	r, err := computeReplacement(f.Name(), re, searchOptions{}, "baz")
+	assert.Nil(t, err)
+	assert.Equal(t, "baz = 1\nbar = 2\nbaz = baz\n", r.content)
+	assert.Equal(t, 2, len(r.changes))
+	assert.Equal(t, 2, r.changes[1].line)
+	assert.Equal(t, 2, r.changes[1].count)
+	assert.Equal(t, "foo = foo", r.changes[1].old)
+
+	opts := searchOptions{regex: true}
+	re, _ = compileSearch(`(\w+) = (\d)`, opts)
+	r, _ = computeReplacement(f.Name(), re, opts, "$2 = $1")
+	assert.Equal(t, "1 = foo\n2 = bar\nfoo = foo\n", r.content)
+
+	re, _ = compileSearch("qux", searchOptions{})
+	r, err = computeReplacement(f.Name(), re, searchOptions{}, "baz")
+	assert.Nil(t, err)
+	assert.Nil(t, r, "no replacement expected when nothing matches")
+}
+
+func TestReplaceInOpenedFile(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "a.txt")
+	ioutil.WriteFile(filename, []byte("foo\nbar\n"), 0644)
+	assert.Nil(t, openAndDisplayFile(g, filename))
+	v := g.Workingview()
+	defer closeView(g, v)
+	views := len(fileViewNames())
+
+	// an unsaved modification unrelated to the replacement
+	v.SetCursor(0, 1)
+	writeInView(v, "x")
+	cmd := []string{"replaceinfiles", "foo", "baz", filepath.Join(dir, ".", "*.txt")}
+	err = replaceInFilesCmd(g, cmd)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ErrModifiedFiles.Error())
+	assert.Equal(t, "foo\nbar\n", getContentFile(filename), "the file should be kept")
+	assert.True(t, isDirty(v), "the buffer should be kept")
+
+	// the preview is made from the buffer
+	assert.Nil(t, saveMain(v, filePath(v)))
+	assert.Nil(t, replaceInFilesCmd(g, cmd))
+	preview, err := g.View(replacePreviewViewName)
+	assert.Nil(t, err)
+	assert.Contains(t, preview.Buffer(), "+ baz")
+	err = tmpSelectHandlers[replacePreviewViewName](g, preview)
+	assert.Equal(t, "1 occurence(s) replaced in 1 file(s)", err.Error())
+	assert.Equal(t, "baz\nxbar\n", getContentFile(filename))
+	assert.Equal(t, views, len(fileViewNames()), "no view should be opened")
+	assert.False(t, isDirty(v))
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/stretto-editor/gocui"
 )
@@ -11,31 +14,293 @@ import (
 var (
 	// ErrPatternNotFound raised when the pattern is not found
 	ErrPatternNotFound = errors.New("Unable to find")
+	// ErrNoPreviousSearch raised when searching again before any search
+	ErrNoPreviousSearch = errors.New("no previous search")
+	// ErrSearchWrappedForward is not a failure : the search reached the
+	// bottom of the buffer and continued at the top
+	ErrSearchWrappedForward = errors.New("search hit BOTTOM, continuing at TOP")
+	// ErrSearchWrappedBackward is not a failure : the search reached the
+	// top of the buffer and continued at the bottom
+	ErrSearchWrappedBackward = errors.New("search hit TOP, continuing at BOTTOM")
 )
 
+// lastSearch is the input of the last search, flags included
+var lastSearch string
+
+// searchOptions describes how a pattern is matched against the buffer
+type searchOptions struct {
+	regex      bool // pattern uses the regexp syntax
+	ignoreCase bool // letters match regardless of their case
+	smartCase  bool // ignore the case unless the pattern has an upper case letter
+	wholeWord  bool // matches must begin and end at a word boundary
+}
+
+// defaultSearchOptions returns the options set in the configuration
+func defaultSearchOptions() searchOptions {
+	return searchOptions{
+		ignoreCase: userconfig.Ignorecase,
+		smartCase:  userconfig.Smartcase,
+		wholeWord:  userconfig.Wholeword,
+	}
+}
+
+// parseSearchFlags toggles the options given by flags (e.g. "-ri").
+// It returns false if flags contains an unknown flag.
+func parseSearchFlags(flags string, opts searchOptions) (searchOptions, bool) {
+	if len(flags) < 2 || flags[0] != '-' {
+		return opts, false
+	}
+	for _, c := range flags[1:] {
+		switch c {
+		case 'r':
+			opts.regex = !opts.regex
+		case 'i':
+			opts.ignoreCase = !opts.ignoreCase
+		case 's':
+			opts.smartCase = !opts.smartCase
+		case 'w':
+			opts.wholeWord = !opts.wholeWord
+		default:
+			return opts, false
+		}
+	}
+	return opts, true
+}
+
+// parseSearchInput separates the leading flags (e.g. "-r ") from the pattern
+// typed in the inputline. The flags toggle the default options. An input
+// which does not start with known flags is kept as is.
+func parseSearchInput(input string) (string, searchOptions) {
+	opts := defaultSearchOptions()
+	i := strings.Index(input, " ")
+	if i < 0 {
+		return input, opts
+	}
+	if flagged, ok := parseSearchFlags(input[:i], opts); ok {
+		return input[i+1:], flagged
+	}
+	return input, opts
+}
+
+// regexEscape matches the escape sequences of a regular expression, which
+// do not tell the case of the pattern (\S, \W, \p{Lu}...)
+var regexEscape = regexp.MustCompile(`\\(?:[pP](?:\{[^}]*\}|.)|.)`)
+
+// hasUpper returns true if the pattern holds an upper case letter, the
+// escape sequences excepted when it is a regular expression
+func hasUpper(pattern string, regex bool) bool {
+	if regex {
+		pattern = regexEscape.ReplaceAllString(pattern, "")
+	}
+	return strings.ToLower(pattern) != pattern
+}
+
+// compileSearch builds the regexp matching the pattern with the given options
+func compileSearch(pattern string, opts searchOptions) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, ErrMissingPattern
+	}
+	expr := pattern
+	if !opts.regex {
+		expr = regexp.QuoteMeta(pattern)
+	}
+	if opts.wholeWord {
+		expr = `\b(?:` + expr + `)\b`
+	}
+	if opts.ignoreCase || (opts.smartCase && !hasUpper(pattern, opts.regex)) {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid regular expression : %s", pattern)
+	}
+	return re, nil
+}
+
+// bufferLines returns the lines of the view, without the trailing newline
+func bufferLines(v *gocui.View) []string {
+	b := v.Buffer()
+	if b == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+}
+
+// absCursor returns the position of the cursor in the buffer
+func absCursor(v *gocui.View) (int, int) {
+	cx, cy := v.Cursor()
+	ox, oy := v.Origin()
+	return cx + ox, cy + oy
+}
+
+// runeToByte converts a position in runes to an index in bytes in s
+func runeToByte(s string, x int) int {
+	for i := range s {
+		if x == 0 {
+			return i
+		}
+		x--
+	}
+	return len(s)
+}
+
+// matchForward looks for the first match strictly after the position (x, y),
+// x being expressed in runes. It returns the position of the match and the
+// submatch indexes (in bytes) within the line.
+func matchForward(lines []string, re *regexp.Regexp, x, y int) (bool, int, int, []int) {
+	start := x + 1
+	for i := y; i < len(lines); i++ {
+		s := lines[i]
+		if start > utf8.RuneCountInString(s) {
+			start = 0
+			continue
+		}
+		b := runeToByte(s, start)
+		for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+			if loc[0] >= b {
+				return true, utf8.RuneCountInString(s[:loc[0]]), i, loc
+			}
+		}
+		start = 0
+	}
+	return false, 0, 0, nil
+}
+
+// matchBackward looks for the last match strictly before the position (x, y)
+func matchBackward(lines []string, re *regexp.Regexp, x, y int) (bool, int, int, []int) {
+	if y >= len(lines) {
+		y, x = len(lines)-1, math.MaxInt32
+	}
+	for i := y; i >= 0; i-- {
+		s := lines[i]
+		b := runeToByte(s, x)
+		if x == math.MaxInt32 {
+			b = len(s) + 1
+		}
+		var last []int
+		for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+			if loc[0] < b {
+				last = loc
+			}
+		}
+		if last != nil {
+			return true, utf8.RuneCountInString(s[:last[0]]), i, last
+		}
+		x = math.MaxInt32
+	}
+	return false, 0, 0, nil
+}
+
+// matchAround looks for the next (or previous) match from the position (x, y)
+// and continues from the other end of the buffer if there is none.
+// wrapped is true if the search had to go past the end of the buffer.
+func matchAround(lines []string, re *regexp.Regexp, x, y int, forward bool) (found, wrapped bool, mx, my int, loc []int) {
+	if forward {
+		if found, mx, my, loc = matchForward(lines, re, x, y); !found {
+			found, mx, my, loc = matchForward(lines, re, -1, 0)
+			wrapped = found
+		}
+	} else {
+		if found, mx, my, loc = matchBackward(lines, re, x, y); !found {
+			found, mx, my, loc = matchBackward(lines, re, 0, len(lines))
+			wrapped = found
+		}
+	}
+	return
+}
+
+// lastSearchInput returns the input of the last search, flags included
+func lastSearchInput(v *gocui.View) string {
+	if lastSearch != "" {
+		return lastSearch
+	}
+	return v.GetSearchString()
+}
+
+func searchPrompt(v *gocui.View, title string) string {
+	if last := lastSearchInput(v); last != "" {
+		return title + " [" + last + "]"
+	}
+	return title
+}
+
 func searchHandler(g *gocui.Gui, v *gocui.View) error {
 
 	currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
 		return nil, search(g, input)
 	}
 
-	if v.GetSearchString() == "" {
-		interactive(g, "Search")
-	} else {
-		interactive(g, "Search [" + v.GetSearchString() + "]")
+	interactive(g, searchPrompt(v, "Search"))
+	return nil
+}
+
+func searchBackwardHandler(g *gocui.Gui, v *gocui.View) error {
+
+	currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
+		return nil, searchBackward(g, input)
 	}
+
+	interactive(g, searchPrompt(v, "Search backward"))
 	return nil
 }
 
+func searchNextHandler(g *gocui.Gui, v *gocui.View) error {
+	displayError(g, searchAgain(g, true))
+	updateInfos(g)
+	return nil
+}
+
+func searchPreviousHandler(g *gocui.Gui, v *gocui.View) error {
+	displayError(g, searchAgain(g, false))
+	updateInfos(g)
+	return nil
+}
+
+// searchAgain repeats the last search in the given direction
+func searchAgain(g *gocui.Gui, forward bool) error {
+	input := lastSearchInput(g.Workingview())
+	if input == "" {
+		return ErrNoPreviousSearch
+	}
+	return doSearch(g, input, forward)
+}
+
 func search(g *gocui.Gui, input string) error {
-	v := g.Workingview()
+	return doSearch(g, input, true)
+}
 
-	if found, x, y := v.SearchForward(input); found == true {
-		v.AbsMoveCursor(x, y, false)
-		return nil
+func searchBackward(g *gocui.Gui, input string) error {
+	return doSearch(g, input, false)
+}
+
+// doSearch moves the cursor of the working view to the next match of input.
+// An empty input repeats the last search.
+func doSearch(g *gocui.Gui, input string, forward bool) error {
+	v := g.Workingview()
+	if input == "" {
+		input = lastSearchInput(v)
 	}
+	lastSearch = input
+	pattern, opts := parseSearchInput(input)
 
-	return fmt.Errorf("Could not find pattern \"%s\" forward", v.GetSearchString())
+	re, err := compileSearch(pattern, opts)
+	if err != nil {
+		return err
+	}
+	x, y := absCursor(v)
+	found, wrapped, x, y, _ := matchAround(bufferLines(v), re, x, y, forward)
+	if !found {
+		return fmt.Errorf("Could not find pattern \"%s\"", pattern)
+	}
+	v.AbsMoveCursor(x, y, false)
+	setSearchHighlight(v, re)
+	if wrapped && forward {
+		return ErrSearchWrappedForward
+	}
+	if wrapped {
+		return ErrSearchWrappedBackward
+	}
+	return nil
 }
 
 func searchAndReplaceHandler(g *gocui.Gui, v *gocui.View) error {
@@ -43,19 +308,24 @@ func searchAndReplaceHandler(g *gocui.Gui, v *gocui.View) error {
 	currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
 
 		v := g.Workingview()
-		var x, y int
-		var found bool
+		pattern, opts := parseSearchInput(input)
 
-		if found, x, y = v.SearchForward(input); !found {
-			return nil, fmt.Errorf("Could not find pattern \"%s\" forward", input)
+		re, err := compileSearch(pattern, opts)
+		if err != nil {
+			return nil, err
+		}
+		lastSearch = input
+		lines := bufferLines(v)
+		x, y := absCursor(v)
+		found, x, y, loc := matchForward(lines, re, x, y)
+		if !found {
+			return nil, fmt.Errorf("Could not find pattern \"%s\" forward", pattern)
 		}
 
-		searched := input
 		interactive(g, "Search and replace - Replace string")
 
 		return func(g *gocui.Gui, input string) (demonInput, error) {
-			v := g.Workingview()
-			replaceAt(v, x, y, searched, input)
+			replaceMatch(g.Workingview(), re, opts, input, lines[y], x, y, loc)
 			return nil, nil
 		}, nil
 
@@ -65,54 +335,133 @@ func searchAndReplaceHandler(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
-func replaceAll(g *gocui.Gui, pattern, replacement string) {
-	v := g.Workingview()
-	v.SetCursor(0, 0)
-	v.SetOrigin(0, 0)
+// replaceMatch replaces the match of the line found at (x, y).
+// The capture groups of the replacement are expanded in regexp mode.
+// It returns the length of the replacement in runes.
+func replaceMatch(v *gocui.View, re *regexp.Regexp, opts searchOptions, replacement, line string, x, y int, loc []int) int {
+	if opts.regex {
+		replacement = string(re.ExpandString(nil, replacement, line, loc))
+	}
+	replaceAt(v, x, y, line[loc[0]:loc[1]], replacement)
+	return utf8.RuneCountInString(replacement)
+}
+
+func queryReplaceHandler(g *gocui.Gui, v *gocui.View) error {
+
+	currentDemonInput = func(g *gocui.Gui, input string) (demonInput, error) {
 
-	found, x, y := v.SearchForward(pattern)
-	for found {
-		replaceAt(v, x, y, pattern, replacement)
-		found, x, y = v.SearchForward(pattern)
+		pattern, opts := parseSearchInput(input)
+		re, err := compileSearch(pattern, opts)
+		if err != nil {
+			return nil, err
+		}
+		lastSearch = input
+
+		interactive(g, "Query replace - Replace string")
+
+		return func(g *gocui.Gui, replacement string) (demonInput, error) {
+			v := g.Workingview()
+			setSearchHighlight(v, re)
+			x, y := absCursor(v)
+			return queryReplaceNext(g, re, opts, replacement, x-1, y, 0)
+		}, nil
 	}
+
+	interactive(g, "Query replace - Search string")
+	return nil
 }
 
-func replaceAt(v *gocui.View, x, y int, oldstring, newstring string) {
-	v.AbsMoveCursor(x, y, false)
-	for i := 0; i < len(oldstring); i++ {
-		v.EditDelete(false)
+// queryReplaceNext moves the cursor to the next match after (x, y) and asks
+// whether it should be replaced. count is the number of replacements
+// already made.
+func queryReplaceNext(g *gocui.Gui, re *regexp.Regexp, opts searchOptions, replacement string, x, y, count int) (demonInput, error) {
+	v := g.Workingview()
+	lines := bufferLines(v)
+	found, mx, my, loc := matchForward(lines, re, x, y)
+	if !found {
+		return nil, replacedCount(count)
 	}
-	for _, c := range newstring {
-		v.EditWrite(c)
+	v.AbsMoveCursor(mx, my, false)
+
+	// next gives the position after which the search goes on once the
+	// match has been replaced by n runes
+	next := func(n int) int {
+		if loc[0] == loc[1] {
+			return mx + n
+		}
+		return mx + n - 1
 	}
-}
 
-// func gives how to move from the current origin
-func searchForward(v *gocui.View, pattern string, x int, y int) (bool, int, int) {
+	var ask demonInput
+	ask = func(g *gocui.Gui, answer string) (demonInput, error) {
+		switch answer {
+		case "y":
+			n := replaceMatch(v, re, opts, replacement, lines[my], mx, my, loc)
+			return queryReplaceNext(g, re, opts, replacement, next(n), my, count+1)
+		case "n":
+			return queryReplaceNext(g, re, opts, replacement, mx, my, count)
+		case "a":
+			n := replaceMatch(v, re, opts, replacement, lines[my], mx, my, loc)
+			return nil, replaceRemaining(v, re, opts, replacement, next(n), my, count+1)
+		case "q":
+			return nil, replacedCount(count)
+		}
+		interactive(g, "Replace ? (y/n/a/q)")
+		return ask, nil
+	}
 
-	if len(pattern) > 0 {
+	interactive(g, "Replace ? (y/n/a/q)")
+	return ask, nil
+}
 
-		var s string
-		var err error
-		var sameline = 1
+// replaceRemaining replaces all the matches after (x, y) without asking
+func replaceRemaining(v *gocui.View, re *regexp.Regexp, opts searchOptions, replacement string, x, y, count int) error {
+	for {
+		lines := bufferLines(v)
+		found, mx, my, loc := matchForward(lines, re, x, y)
+		if !found {
+			return replacedCount(count)
+		}
+		n := replaceMatch(v, re, opts, replacement, lines[my], mx, my, loc)
+		if x, y = mx+n-1, my; loc[0] == loc[1] {
+			x++
+		}
+		count++
+	}
+}
 
-		for i := 0; err == nil; i++ {
-			s, err = v.Line(y + i)
-			if err == nil {
+// replacedCount reports the number of replacements made in the error view
+func replacedCount(count int) error {
+	return fmt.Errorf("%d occurence(s) replaced", count)
+}
 
-				if x < len(s) {
-					indice := strings.Index(s[x+sameline:], pattern)
+// replaceInLine replaces every match of the line. In regexp mode, the
+// capture group references ($1, ${name}) of the replacement are expanded.
+func replaceInLine(re *regexp.Regexp, opts searchOptions, replacement, line string) string {
+	if opts.regex {
+		return re.ReplaceAllString(line, replacement)
+	}
+	return re.ReplaceAllLiteralString(line, replacement)
+}
 
-					if indice >= 0 {
-						if sameline == 0 {
-							return true, indice + sameline, y + i
-						}
-						return true, indice + sameline + x, y + i
-					}
-				}
-				x, sameline = 0, 0
-			}
+// replaceAll replaces every match in the view
+func replaceAll(v *gocui.View, re *regexp.Regexp, opts searchOptions, replacement string) {
+	for y, line := range bufferLines(v) {
+		if newline := replaceInLine(re, opts, replacement, line); newline != line {
+			replaceAt(v, 0, y, line, newline)
 		}
 	}
-	return false, 0, 0
+	v.SetCursor(0, 0)
+	v.SetOrigin(0, 0)
+}
+
+func replaceAt(v *gocui.View, x, y int, oldstring, newstring string) {
+	v.AbsMoveCursor(x, y, false)
+	for i := 0; i < utf8.RuneCountInString(oldstring); i++ {
+		v.EditDelete(false)
+	}
+	for _, c := range newstring {
+		v.EditWrite(c)
+	}
+	bufferEdited(v, y)
 }
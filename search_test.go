@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchInput(t *testing.T) {
+	pattern, opts := parseSearchInput("foo")
+	assert.Equal(t, "foo", pattern)
+	assert.False(t, opts.regex, "no flag should give a literal search")
+
+	pattern, opts = parseSearchInput("-r fo+ bar")
+	assert.Equal(t, "fo+ bar", pattern)
+	assert.True(t, opts.regex, "-r should enable the regexp mode")
+
+	// unknown flags are part of the pattern
+	pattern, opts = parseSearchInput("-x foo")
+	assert.Equal(t, "-x foo", pattern)
+	assert.False(t, opts.regex)
+
+	pattern, _ = parseSearchInput("-r")
+	assert.Equal(t, "-r", pattern, "a lonely flag should be searched as is")
+}
+
+func TestMatchForward(t *testing.T) {
+	lines := []string{"foo bar", "héhé foo1", "", "foo22"}
+	re, err := compileSearch(`foo(\d+)`, searchOptions{regex: true})
+	assert.Nil(t, err)
+
+	found, x, y, loc := matchForward(lines, re, 0, 0)
+	assert.True(t, found)
+	assert.Equal(t, 5, x, "position should be expressed in runes")
+	assert.Equal(t, 1, y)
+	assert.Equal(t, "1", lines[y][loc[2]:loc[3]])
+
+	found, x, y, _ = matchForward(lines, re, x, y)
+	assert.True(t, found)
+	assert.Equal(t, 0, x)
+	assert.Equal(t, 3, y)
+
+	found, _, _, _ = matchForward(lines, re, x, y)
+	assert.False(t, found)
+
+	_, err = compileSearch("foo(", searchOptions{regex: true})
+	assert.NotNil(t, err, "invalid regexp should be reported")
+
+	// literal patterns are not interpreted
+	re, _ = compileSearch("a.c", searchOptions{})
+	found, _, _, _ = matchForward([]string{"abc a.c"}, re, 0, 0)
+	assert.True(t, found)
+	found, _, _, _ = matchForward([]string{"abc"}, re, 0, 0)
+	assert.False(t, found)
+}
+
+func TestMatchBackward(t *testing.T) {
+	lines := []string{"foo foo", "bar", "foo"}
+	re, _ := compileSearch("foo", searchOptions{})
+
+	found, x, y, _ := matchBackward(lines, re, 0, 2)
+	assert.True(t, found)
+	assert.Equal(t, 4, x, "the last occurence of the line should be found")
+	assert.Equal(t, 0, y)
+
+	found, x, y, _ = matchBackward(lines, re, x, y)
+	assert.True(t, found)
+	assert.Equal(t, 0, x)
+	assert.Equal(t, 0, y)
+
+	found, _, _, _ = matchBackward(lines, re, x, y)
+	assert.False(t, found)
+}
+
+func TestMatchAround(t *testing.T) {
+	lines := []string{"foo", "bar", "foo"}
+	re, _ := compileSearch("foo", searchOptions{})
+
+	found, wrapped, x, y, _ := matchAround(lines, re, 0, 2, true)
+	assert.True(t, found)
+	assert.True(t, wrapped, "the search should continue at the top")
+	assert.Equal(t, 0, x)
+	assert.Equal(t, 0, y)
+
+	found, wrapped, _, y, _ = matchAround(lines, re, 0, 0, false)
+	assert.True(t, found)
+	assert.True(t, wrapped, "the search should continue at the bottom")
+	assert.Equal(t, 2, y)
+
+	found, wrapped, _, y, _ = matchAround(lines, re, 0, 0, true)
+	assert.True(t, found)
+	assert.False(t, wrapped)
+	assert.Equal(t, 2, y)
+
+	re, _ = compileSearch("baz", searchOptions{})
+	found, _, _, _, _ = matchAround(lines, re, 0, 0, true)
+	assert.False(t, found)
+}
+
+func TestSearchFlags(t *testing.T) {
+	pattern, opts := parseSearchInput("-iw foo")
+	assert.Equal(t, "foo", pattern)
+	assert.True(t, opts.ignoreCase)
+	assert.True(t, opts.wholeWord)
+	assert.False(t, opts.regex)
+
+	// flags toggle the default options
+	opts, ok := parseSearchFlags("-ii", searchOptions{})
+	assert.True(t, ok)
+	assert.False(t, opts.ignoreCase, "a flag given twice should cancel itself")
+
+	_, ok = parseSearchFlags("-", searchOptions{})
+	assert.False(t, ok)
+}
+
+func TestCompileSearchOptions(t *testing.T) {
+	re, _ := compileSearch("foo", searchOptions{ignoreCase: true})
+	assert.True(t, re.MatchString("a FoO"))
+
+	re, _ = compileSearch("foo", searchOptions{smartCase: true})
+	assert.True(t, re.MatchString("a FoO"), "lower case pattern should ignore the case")
+	re, _ = compileSearch("Foo", searchOptions{smartCase: true})
+	assert.False(t, re.MatchString("a FOO"), "upper case letter should make the search case sensitive")
+	assert.True(t, re.MatchString("a Foo"))
+	re, _ = compileSearch(`foo\S+\B\p{Lu}`, searchOptions{smartCase: true, regex: true})
+	assert.True(t, re.MatchString("a FOO-BAR"), "the escape sequences should not make the search case sensitive")
+	re, _ = compileSearch(`Foo\s`, searchOptions{smartCase: true, regex: true})
+	assert.False(t, re.MatchString("a foo "))
+
+	re, _ = compileSearch("foo", searchOptions{wholeWord: true})
+	assert.False(t, re.MatchString("foobar"))
+	assert.True(t, re.MatchString("a foo."))
+
+	re, _ = compileSearch("fo+|bar", searchOptions{regex: true, wholeWord: true})
+	assert.False(t, re.MatchString("fooo_bar"))
+	assert.True(t, re.MatchString("(bar)"))
+
+	re, _ = compileSearch("foo", searchOptions{})
+	assert.False(t, re.MatchString("FOO"), "search should be case sensitive by default")
+}
+
+// queryReplace starts a query replace of pattern from the beginning of the
+// working view and gives the answers in order. It returns the error of the
+// last answer.
+func queryReplace(t *testing.T, content, pattern string, opts searchOptions, replacement string, answers ...string) (string, error) {
+	g := initGui()
+	defer g.Close()
+
+	v := g.Workingview()
+	v.Clear()
+	fmt.Fprint(v, content)
+	re, err := compileSearch(pattern, opts)
+	assert.Nil(t, err)
+	ask, err := queryReplaceNext(g, re, opts, replacement, -1, 0, 0)
+	for _, a := range answers {
+		if ask == nil {
+			break
+		}
+		ask, err = ask(g, a)
+	}
+	assert.Nil(t, ask, "the query replace should be over")
+	return strings.TrimSuffix(v.Buffer(), "\n"), err
+}
+
+func TestQueryReplace(t *testing.T) {
+	content, err := queryReplace(t, "foo foo\nfoo", "foo", searchOptions{}, "x", "y", "n", "y")
+	assert.Equal(t, "x foo\nx", content)
+	assert.Equal(t, replacedCount(2), err)
+
+	content, err = queryReplace(t, "foo foo\nfoo", "foo", searchOptions{}, "x", "n", "q")
+	assert.Equal(t, "foo foo\nfoo", content, "q should stop without replacing")
+	assert.Equal(t, replacedCount(0), err)
+
+	content, err = queryReplace(t, "foo foo\nfoo foo", "foo", searchOptions{}, "bar", "n", "a")
+	assert.Equal(t, "foo bar\nbar bar", content, "a should replace all the remaining matches")
+	assert.Equal(t, replacedCount(3), err)
+
+	content, err = queryReplace(t, "foo", "foo", searchOptions{}, "x", "?", "y")
+	assert.Equal(t, "x", content, "an unknown answer should ask again")
+	assert.Equal(t, replacedCount(1), err)
+}
+
+func TestQueryReplaceLength(t *testing.T) {
+	content, err := queryReplace(t, "ab ab ab", "ab", searchOptions{}, "longer", "y", "y", "y")
+	assert.Equal(t, "longer longer longer", content, "the matches after a longer replacement should be found")
+	assert.Equal(t, replacedCount(3), err)
+
+	content, _ = queryReplace(t, "long long long", "long", searchOptions{}, "s", "y", "n", "y")
+	assert.Equal(t, "s long s", content, "the matches after a shorter replacement should be found")
+
+	content, _ = queryReplace(t, "aaa", "a", searchOptions{}, "aa", "a")
+	assert.Equal(t, "aaaaaa", content, "a replacement should not be replaced again")
+}
+
+func TestQueryReplaceEmptyMatch(t *testing.T) {
+	opts := searchOptions{regex: true}
+	content, err := queryReplace(t, "ab\nc", "x*", opts, "-", "y", "y", "y", "y", "y")
+	assert.Equal(t, "-a-b-\n-c-", content, "each empty match should be replaced once")
+	assert.Equal(t, replacedCount(5), err)
+
+	content, err = queryReplace(t, "ab\nc", "x*", opts, "-", "n", "a")
+	assert.Equal(t, "a-b-\n-c-", content)
+	assert.Equal(t, replacedCount(4), err)
+
+	content, err = queryReplace(t, "ab", "^", opts, "> ", "a")
+	assert.Equal(t, "> ab", content, "the search should go past an empty match")
+	assert.Equal(t, replacedCount(1), err)
+}
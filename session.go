@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// defaultSessionFile is the file of the sessions when none is given
+const defaultSessionFile = ".stretto-session.json"
+
+// sessionBuffer is an opened file of a session, with the position of its
+// cursor and of its origin
+type sessionBuffer struct {
+	File     string `json:"file"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	OriginX  int    `json:"originx"`
+	OriginY  int    `json:"originy"`
+	Wrap     bool   `json:"wrap"`
+	ReadOnly bool   `json:"readonly"`
+}
+
+// session gives the opened files, in the order of the buffers, the current
+// one and the current mode
+type session struct {
+	Buffers []sessionBuffer `json:"buffers"`
+	Current string          `json:"current"`
+	Mode    string          `json:"mode"`
+}
+
+// sessionFile returns the file given in argument of a session command
+func sessionFile(cmd []string) string {
+	if len(cmd) > 1 {
+		return cmd[1]
+	}
+	return defaultSessionFile
+}
+
+// currentSession returns the session of the buffers whose file exists. The
+// unsaved modifications are not kept.
+func currentSession(g *gocui.Gui) session {
+	s := session{Mode: g.CurrentMode().Name()}
+	if s.Mode == cmdMode {
+		s.Mode = modeBeforeCmd
+	}
+	working := ""
+	if v := g.Workingview(); v != nil {
+		working = sourceOf(v.Name())
+	}
+	for _, name := range fileViewNames() {
+		v, err := g.View(name)
+		if err != nil || filePath(v) == "" {
+			continue
+		}
+		if _, err := os.Stat(filePath(v)); err != nil {
+			continue
+		}
+		// the session may be loaded from another directory
+		path, err := filepath.Abs(filePath(v))
+		if err != nil {
+			continue
+		}
+		x, y := v.Cursor()
+		ox, oy := v.Origin()
+		// the origin of a large file is a line of the loaded lines
+		if lf, ok := largeFiles[name]; ok {
+			oy += lf.first
+		}
+		s.Buffers = append(s.Buffers, sessionBuffer{
+			File: path, X: x, Y: y, OriginX: ox, OriginY: oy,
+			Wrap: v.Wrap, ReadOnly: isReadOnly(v),
+		})
+		if name == working {
+			s.Current = path
+		}
+	}
+	return s
+}
+
+// saveSession writes the session in the file in JSON
+func saveSession(g *gocui.Gui, filename string) error {
+	data, err := json.MarshalIndent(currentSession(g), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("Could not save the session : %v", err)
+	}
+	return nil
+}
+
+// restoreBuffer opens the file of the buffer, or takes the view already
+// displaying it, and puts back its positions
+func restoreBuffer(g *gocui.Gui, b sessionBuffer) (*gocui.View, error) {
+	v := openedFileView(g, b.File)
+	if v == nil {
+		var err error
+		if b.ReadOnly {
+			err = viewFile(g, b.File)
+		} else {
+			err = openAndDisplayFile(g, b.File)
+		}
+		v = g.Workingview()
+		if err != nil {
+			closeView(g, v)
+			return nil, err
+		}
+	}
+	v.Wrap = b.Wrap
+	if lf, ok := largeFiles[v.Name()]; ok {
+		// the window keeps the line of the cursor in the screen
+		v.SetCursor(b.X, b.Y)
+		return v, loadLargeWindow(v, lf, b.OriginY+b.Y)
+	}
+	v.SetOrigin(b.OriginX, b.OriginY)
+	v.SetCursor(b.X, b.Y)
+	return v, nil
+}
+
+// loadSession opens the files of the session saved in the file and shows
+// its current file in its mode. The files which cannot be opened are
+// skipped, the last error is returned.
+func loadSession(g *gocui.Gui, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Could not load the session : %v", err)
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("Could not load the session : %v", err)
+	}
+	var current *gocui.View
+	var lastErr error
+	for _, b := range s.Buffers {
+		v, err := restoreBuffer(g, b)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if current == nil || b.File == s.Current {
+			current = v
+		}
+	}
+	if current == nil {
+		return lastErr
+	}
+	showBuffer(g, current.Name())
+	if s.Mode != editMode && s.Mode != fileMode {
+		return lastErr
+	}
+	if g.CurrentMode().Name() == cmdMode {
+		// loadsession is run from the command mode, the mode is given
+		// when leaving it
+		modeAfterCmd = s.Mode
+	} else if g.CurrentMode().Name() != s.Mode {
+		doSwitchMode(g, s.Mode)
+	}
+	return lastErr
+}
+
+func mkSessionCmd(g *gocui.Gui, cmd []string) error {
+	return saveSession(g, sessionFile(cmd))
+}
+
+func loadSessionCmd(g *gocui.Gui, cmd []string) error {
+	return loadSession(g, sessionFile(cmd))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "session.json")
+
+	openAndDisplayFile(g, "Commands.md")
+	commands := g.Workingview()
+	commands.Wrap = false
+	commands.SetOrigin(0, 2)
+	commands.SetCursor(3, 1)
+	viewFile(g, "LICENSE")
+	newFileHandler(g, nil)
+	showBuffer(g, "Commands.md")
+	doSwitchMode(g, fileMode)
+	doSwitchMode(g, cmdMode)
+
+	err = mkSessionCmd(g, []string{"mksession", filename})
+	assert.Nil(t, err, "No error should be found")
+	s := currentSession(g)
+	assert.Equal(t, fileMode, s.Mode, "the mode before the command mode should be saved")
+	abs, _ := filepath.Abs("Commands.md")
+	assert.Equal(t, abs, s.Current, "the paths should be absolute")
+	for _, b := range s.Buffers {
+		assert.NotEqual(t, "", b.File, "the buffers without file should be skipped")
+	}
+
+	doSwitchMode(g, editMode)
+	closeView(g, commands)
+	license, _ := g.View("LICENSE")
+	closeView(g, license)
+
+	// the command is validated from the command mode, the saved mode is
+	// given when leaving it
+	doSwitchMode(g, cmdMode)
+	cmdline, _ := g.View("cmdline")
+	writeInView(cmdline, "loadsession "+filename)
+	err = validateCmd(g, cmdline)
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, cmdMode, g.CurrentMode().Name())
+	leaveCmdModeHandler(g, cmdline)
+	assert.Equal(t, fileMode, g.CurrentMode().Name())
+	v := g.Workingview()
+	assert.Equal(t, abs, v.Name())
+	assert.False(t, v.Wrap)
+	ox, oy := v.Origin()
+	cx, cy := v.Cursor()
+	assert.Equal(t, []int{0, 2, 3, 1}, []int{ox, oy, cx, cy})
+	license, err = g.View("LICENSE")
+	assert.Nil(t, err, "LICENSE should be opened again")
+	assert.True(t, isReadOnly(license), "LICENSE should be read-only")
+	doSwitchMode(g, cmdMode)
+	leaveCmdModeHandler(g, cmdline)
+	assert.Equal(t, editMode, g.CurrentMode().Name(), "the saved mode should be given once")
+
+	assert.NotNil(t, loadSessionCmd(g, []string{"loadsession", filepath.Join(dir, "none.json")}))
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/stretto-editor/gocui"
+)
+
+const (
+	noSplit = iota
+	// horizontalSplit puts the panes one above the other
+	horizontalSplit
+	// verticalSplit puts the panes side by side
+	verticalSplit
+)
+
+// ErrSplitLargeFile raised when splitting a file opened in large file mode
+var ErrSplitLargeFile = errors.New("files opened in large file mode cannot be split")
+
+// ErrStaleHistory raised when undoing in a pane whose file was modified in
+// another pane
+var ErrStaleHistory = errors.New("undo is not available, the file was modified in another pane")
+
+// staleHistories are the views whose undo history does not match their
+// content anymore, because the file was modified in another pane. Each
+// pane only records its own modifications.
+var staleHistories = map[string]bool{}
+
+// pane is a part of the screen displaying a file view, or split in two
+// panes
+type pane struct {
+	view     string  // file view displayed by a pane which is not split
+	split    int     // noSplit, horizontalSplit or verticalSplit
+	ratio    float64 // part of the pane given to the first child
+	children [2]*pane
+	parent   *pane
+}
+
+var (
+	// rootPane is the pane of the whole screen, nil when it is not split
+	rootPane *pane
+	// focusPane is the pane of the working view
+	focusPane *pane
+)
+
+// linkedTo gives, for the views showing the same buffer as another view in
+// a second pane, the view they are linked to
+var linkedTo = map[string]string{}
+
+// pendingSyncs gives, by source view, the view whose buffer was modified
+// since the linked views were last synchronized
+var pendingSyncs = map[string]string{}
+
+// leaves returns the panes which are not split, from left to right and top
+// to bottom
+func (p *pane) leaves() []*pane {
+	if p == nil {
+		return nil
+	}
+	if p.split == noSplit {
+		return []*pane{p}
+	}
+	return append(p.children[0].leaves(), p.children[1].leaves()...)
+}
+
+// paneOf returns the pane displaying the view, or nil
+func paneOf(name string) *pane {
+	for _, l := range rootPane.leaves() {
+		if l.view == name {
+			return l
+		}
+	}
+	return nil
+}
+
+// paneGeometry returns the geometry of the view in the area (x, y, w, h) of
+// the screen given to the file views. Views outside of the panes take the
+// whole area.
+func paneGeometry(name string, x, y, w, h int) (int, int, int, int) {
+	target := paneOf(name)
+	if target == nil {
+		return x, y, w, h
+	}
+	var path []*pane
+	for p := target; p.parent != nil; p = p.parent {
+		path = append([]*pane{p}, path...)
+	}
+	for _, p := range path {
+		parent := p.parent
+		first := p == parent.children[0]
+		if parent.split == horizontalSplit {
+			h1 := int(float64(h) * parent.ratio)
+			if first {
+				h = h1
+			} else {
+				y, h = y+h1, h-h1
+			}
+		} else {
+			w1 := int(float64(w) * parent.ratio)
+			if first {
+				w = w1
+			} else {
+				x, w = x+w1, w-w1
+			}
+		}
+	}
+	return x, y, w, h
+}
+
+// sourceOf returns the view the view is linked to, or the view itself
+func sourceOf(name string) string {
+	if src, ok := linkedTo[name]; ok {
+		return src
+	}
+	return name
+}
+
+// linkedViews returns the views showing the same buffer as the view,
+// including itself
+func linkedViews(name string) []string {
+	src := sourceOf(name)
+	names := []string{src}
+	for clone, s := range linkedTo {
+		if s == src {
+			names = append(names, clone)
+		}
+	}
+	return names
+}
+
+// linkedEdited records the modification of the buffer of the view, which is
+// given to the views linked to it by the next layout
+func linkedEdited(v *gocui.View) {
+	if len(linkedTo) > 0 && len(linkedViews(v.Name())) > 1 {
+		pendingSyncs[sourceOf(v.Name())] = v.Name()
+	}
+}
+
+// syncPendingViews synchronizes the views linked to the modified views
+func syncPendingViews(g *gocui.Gui) {
+	for src, name := range pendingSyncs {
+		delete(pendingSyncs, src)
+		if v, err := g.View(name); err == nil {
+			syncLinkedViews(g, v)
+		}
+	}
+}
+
+// syncLinkedViews copies the content and the saved state of the view to the
+// views linked to it, keeping their cursor
+func syncLinkedViews(g *gocui.Gui, v *gocui.View) {
+	names := linkedViews(v.Name())
+	if len(names) == 1 {
+		return
+	}
+	shareFileState(v.Name())
+	content := strings.TrimSuffix(v.Buffer(), "\n")
+	for _, name := range names {
+		m, err := g.View(name)
+		if err != nil || name == v.Name() {
+			continue
+		}
+		cx, cy := m.Cursor()
+		ox, oy := m.Origin()
+		m.Clear()
+		fmt.Fprint(m, content)
+		forgetRender(name)
+		staleHistories[name] = true
+		m.SetOrigin(ox, oy)
+		m.SetCursor(cx, cy)
+		refreshTitle(m)
+	}
+}
+
+// shareFileState gives the saved state of the view to the views linked to it
+func shareFileState(name string) {
+	for _, m := range linkedViews(name) {
+		if m == name {
+			continue
+		}
+		if h, ok := savedHashes[name]; ok {
+			savedHashes[m] = h
+		}
+		dirtyViews[m] = dirtyViews[name]
+		if s, ok := fileStamps[name]; ok {
+			fileStamps[m] = s
+		}
+		if f, ok := fileFormats[name]; ok {
+			fileFormats[m] = f
+		}
+		filePaths[m] = filePaths[name]
+	}
+}
+
+// cloneView creates a view linked to v, showing the same buffer with its
+// own cursor
+func cloneView(g *gocui.Gui, v *gocui.View) (*gocui.View, error) {
+	if _, ok := largeFiles[v.Name()]; ok {
+		return nil, ErrSplitLargeFile
+	}
+	src := sourceOf(v.Name())
+	name := src
+	for i := 2; ; i++ {
+		name = fmt.Sprintf("%s (%d)", src, i)
+		if _, ok := requiredViewsInfo[name]; !ok {
+			break
+		}
+	}
+	c, _ := newFileView(g, name)
+	removeBuffer(name)
+	linkedTo[name] = src
+	fmt.Fprint(c, strings.TrimSuffix(v.Buffer(), "\n"))
+	setFilePath(c, filePath(v))
+	c.Editable = v.Editable
+	c.Wrap = v.Wrap
+	ox, oy := v.Origin()
+	cx, cy := v.Cursor()
+	c.SetOrigin(ox, oy)
+	c.SetCursor(cx, cy)
+	if f, ok := fileFormats[v.Name()]; ok {
+		fileFormats[name] = f
+	}
+	readOnlyViews[name] = readOnlyViews[v.Name()]
+	unwritableViews[name] = unwritableViews[v.Name()]
+	shareFileState(v.Name())
+	return c, nil
+}
+
+// unlinkView removes the view from the views showing its buffer. When it
+// is the source of other views, the first one takes its place in the
+// buffers.
+func unlinkView(name string) {
+	if _, ok := linkedTo[name]; ok {
+		delete(linkedTo, name)
+		return
+	}
+	names := linkedViews(name)
+	if len(names) == 1 {
+		return
+	}
+	heir := names[1]
+	delete(linkedTo, heir)
+	for _, clone := range names[2:] {
+		linkedTo[clone] = heir
+	}
+	for i, n := range bufferOrder {
+		if n == name {
+			bufferOrder[i] = heir
+		}
+	}
+	tabbarStale = true
+	if edited, ok := pendingSyncs[name]; ok {
+		delete(pendingSyncs, name)
+		pendingSyncs[heir] = edited
+	}
+}
+
+// splitPane splits the focused pane and displays the file, or the working
+// view when filename is empty, in the new pane
+func splitPane(g *gocui.Gui, split int, filename string) error {
+	w := g.Workingview()
+	if rootPane == nil {
+		rootPane = &pane{view: w.Name()}
+		focusPane = rootPane
+	}
+	focusPane.view = w.Name()
+
+	var v *gocui.View
+	var err error
+	if filename == "" {
+		v, err = cloneView(g, w)
+	} else if opened := openedFileView(g, filename); opened != nil {
+		v, err = cloneView(g, opened)
+	} else {
+		err = openAndDisplayFile(g, filename)
+		v = g.Workingview()
+	}
+	if err != nil {
+		if v := g.Workingview(); v.Name() != w.Name() {
+			// the view of the file which could not be opened
+			g.DeleteView(v.Name())
+			removeInfoView(v.Name())
+			removeFileState(v.Name())
+		}
+		g.SetWorkingView(w.Name())
+		if rootPane.split == noSplit {
+			rootPane, focusPane = nil, nil
+		}
+		return err
+	}
+
+	p := focusPane
+	p.children[0] = &pane{view: p.view, parent: p}
+	p.children[1] = &pane{view: v.Name(), parent: p}
+	p.view, p.split, p.ratio = "", split, 0.5
+	focusPane = p.children[1]
+	return showPane(g, focusPane)
+}
+
+// showPane makes the view of the pane the working view
+func showPane(g *gocui.Gui, p *pane) error {
+	focusPane = p
+	g.SetWorkingView(p.view)
+	if g.CurrentMode().Name() != cmdMode {
+		g.SetCurrentView(p.view)
+		g.SetViewOnTop(p.view)
+	}
+	readOnlyFileMode(g)
+	updateInfos(g)
+	return nil
+}
+
+// removePane removes the pane, its sibling takes the place of their parent.
+// It returns the view to focus afterwards, "" when the pane was the only one.
+func removePane(g *gocui.Gui, p *pane) string {
+	parent := p.parent
+	if parent == nil {
+		unsplit(g)
+		return ""
+	}
+	sibling := parent.children[0]
+	if sibling == p {
+		sibling = parent.children[1]
+	}
+	*parent = pane{
+		view:     sibling.view,
+		split:    sibling.split,
+		ratio:    sibling.ratio,
+		children: sibling.children,
+		parent:   parent.parent,
+	}
+	for _, c := range parent.children {
+		if c != nil {
+			c.parent = parent
+		}
+	}
+	next := parent.leaves()[0]
+	switch focusPane {
+	case p:
+		focusPane = next
+	case sibling:
+		focusPane = parent
+	}
+	if rootPane.split == noSplit {
+		g.SetWorkingView(next.view)
+		unsplit(g)
+		return g.Workingview().Name()
+	}
+	return next.view
+}
+
+// unsplit displays the working view in the whole screen. The views linked
+// to another one are closed.
+func unsplit(g *gocui.Gui) {
+	rootPane, focusPane = nil, nil
+	syncPendingViews(g)
+	for _, name := range linkedViewNames() {
+		dropLinkedView(g, name)
+	}
+	for _, name := range fileViewNames() {
+		if v, err := g.View(name); err == nil {
+			v.Hidden = false
+		}
+	}
+}
+
+// dropLinkedView closes a view linked to another view, which keeps the
+// content of the buffer. The history of the buffer is given back once it is
+// displayed in a single pane.
+func dropLinkedView(g *gocui.Gui, name string) {
+	src := sourceOf(name)
+	if w := g.Workingview(); w != nil && w.Name() == name {
+		g.SetWorkingView(src)
+		if g.CurrentMode().Name() != cmdMode {
+			g.SetCurrentView(src)
+			g.SetViewOnTop(src)
+		}
+	}
+	unlinkView(name)
+	g.DeleteView(name)
+	removeInfoView(name)
+	removeHighlights(name)
+	removeFileState(name)
+	if len(linkedViews(src)) == 1 {
+		delete(staleHistories, src)
+	}
+}
+
+// linkedViewNames returns the names of the views linked to another view
+func linkedViewNames() []string {
+	var names []string
+	for name := range linkedTo {
+		names = append(names, name)
+	}
+	return names
+}
+
+// closePaneOf removes the pane of the view when it is closed, and returns
+// the view to focus afterwards, or nil
+func closePaneOf(g *gocui.Gui, name string) *gocui.View {
+	unlinkView(name)
+	p := paneOf(name)
+	if p == nil {
+		return nil
+	}
+	if next := removePane(g, p); next != "" {
+		v, _ := g.View(next)
+		return v
+	}
+	return nil
+}
+
+// refreshPanes puts the working view in the focused pane, hides the file
+// views which are not in a pane, and synchronizes the linked views which
+// were modified. It is called by the layout, after each event.
+func refreshPanes(g *gocui.Gui) {
+	syncPendingViews(g)
+	w := g.Workingview()
+	if rootPane == nil || w == nil {
+		return
+	}
+	for _, l := range rootPane.leaves() {
+		if _, err := g.View(l.view); err != nil {
+			removePane(g, l)
+			if rootPane == nil {
+				return
+			}
+		}
+	}
+	if info, ok := requiredViewsInfo[w.Name()]; ok && info.c == "main" {
+		if p := paneOf(w.Name()); p != nil {
+			focusPane = p
+		} else {
+			focusPane.view = w.Name()
+		}
+	}
+	// a linked view only lives in its pane
+	for _, name := range linkedViewNames() {
+		if paneOf(name) == nil {
+			dropLinkedView(g, name)
+		}
+	}
+	for _, name := range fileViewNames() {
+		if v, err := g.View(name); err == nil {
+			v.Hidden = paneOf(name) == nil
+		}
+	}
+}
+
+// focusPaneHandlerFactory returns a handler focusing the pane delta panes
+// after the focused one
+func focusPaneHandlerFactory(delta int) gocui.KeybindingHandler {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		leaves := rootPane.leaves()
+		for i, l := range leaves {
+			if l == focusPane {
+				return showPane(g, leaves[(i+delta+len(leaves))%len(leaves)])
+			}
+		}
+		return nil
+	}
+}
+
+// resizePaneHandlerFactory returns a handler growing (positive delta) or
+// shrinking the focused pane
+func resizePaneHandlerFactory(delta float64) gocui.KeybindingHandler {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		resizePane(focusPane, delta)
+		return nil
+	}
+}
+
+func resizePane(p *pane, delta float64) {
+	if p == nil || p.parent == nil {
+		return
+	}
+	parent := p.parent
+	if p == parent.children[1] {
+		delta = -delta
+	}
+	parent.ratio += delta
+	if parent.ratio < 0.1 {
+		parent.ratio = 0.1
+	}
+	if parent.ratio > 0.9 {
+		parent.ratio = 0.9
+	}
+}
+
+func splitCmd(g *gocui.Gui, cmd []string) error {
+	return splitPane(g, horizontalSplit, strings.Join(cmd[1:], " "))
+}
+
+func vsplitCmd(g *gocui.Gui, cmd []string) error {
+	return splitPane(g, verticalSplit, strings.Join(cmd[1:], " "))
+}
+
+// closePaneCmd removes the focused pane. The view linked to another view
+// is closed, the other views stay opened as buffers.
+func closePaneCmd(g *gocui.Gui, cmd []string) error {
+	if focusPane == nil {
+		return nil
+	}
+	name := focusPane.view
+	if _, ok := linkedTo[name]; ok {
+		closeView(g, g.Workingview())
+		return nil
+	}
+	if next := removePane(g, focusPane); next != "" {
+		return showBuffer(g, next)
+	}
+	return nil
+}
+
+// unsplitCmd displays the working view in the whole screen
+func unsplitCmd(g *gocui.Gui, cmd []string) error {
+	unsplit(g)
+	return nil
+}
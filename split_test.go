@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+	defer unsplit(g)
+
+	openAndDisplayFile(g, "LICENSE")
+	source := g.Workingview()
+	source.SetCursor(0, 3)
+
+	err := vsplitCmd(g, []string{"vsplit"})
+	assert.Nil(t, err, "No error should be found")
+	clone := g.Workingview()
+	assert.Equal(t, "LICENSE (2)", clone.Name())
+	assert.Equal(t, "LICENSE", filePath(clone))
+	assert.Equal(t, 2, len(rootPane.leaves()))
+	assert.NotContains(t, fileViewNames(), clone.Name(), "a linked view is not a buffer")
+
+	layout(g)
+	left, right := requiredViewsInfo["LICENSE"], requiredViewsInfo[clone.Name()]
+	assert.Equal(t, []int{-1, 0, 40, 21}, []int{left.x, left.y, left.w, left.h})
+	assert.Equal(t, []int{39, 0, 41, 21}, []int{right.x, right.y, right.w, right.h})
+
+	// independent cursors, same content
+	clone.SetCursor(0, 0)
+	writeInView(clone, "foo")
+	layout(g)
+	_, cy := source.Cursor()
+	assert.Equal(t, 3, cy, "the cursor of the other pane should not move")
+	assert.Equal(t, clone.Buffer(), source.Buffer(), "the buffer should be the same in both panes")
+	assert.True(t, isDirty(source), "the buffer should be modified")
+
+	focusPaneHandlerFactory(1)(g, nil)
+	assert.Equal(t, "LICENSE", g.Workingview().Name())
+	resizePaneHandlerFactory(0.1)(g, nil)
+	assert.InDelta(t, 0.6, rootPane.ratio, 0.001)
+
+	err = splitCmd(g, []string{"split", "Commands.md"})
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, "Commands.md", g.Workingview().Name())
+	assert.Equal(t, 3, len(rootPane.leaves()))
+
+	err = closePaneCmd(g, []string{"closepane"})
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, 2, len(rootPane.leaves()))
+	assert.Equal(t, "LICENSE", g.Workingview().Name())
+	layout(g)
+	commands, _ := g.View("Commands.md")
+	assert.True(t, commands.Hidden, "a buffer out of the panes should be hidden")
+
+	focusPaneHandlerFactory(1)(g, nil)
+	assert.Equal(t, clone.Name(), g.Workingview().Name())
+	closeFileHandler(g, clone)
+	assert.Nil(t, rootPane, "the screen should not be split anymore")
+	assert.Equal(t, "LICENSE", g.Workingview().Name())
+	assert.Nil(t, currentDemonInput, "the buffer is still opened, no need to save it")
+	assert.False(t, commands.Hidden)
+}
+
+func TestUndoInSplit(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+	defer unsplit(g)
+
+	openAndDisplayFile(g, "LICENSE")
+	source := g.Workingview()
+	defer closeView(g, source)
+	assert.Nil(t, vsplitCmd(g, []string{"vsplit"}))
+	clone := g.Workingview()
+
+	clone.SetCursor(0, 0)
+	writeInView(clone, "foo")
+	layout(g)
+	buffer := source.Buffer()
+	errView, _ := g.View("error")
+
+	errView.Clear()
+	undoHandler(g, clone)
+	assert.Empty(t, errView.Buffer(), "the pane which modified the file may undo")
+
+	undoHandler(g, source)
+	assert.Contains(t, errView.Buffer(), ErrStaleHistory.Error(), "the history of the other pane is stale")
+	assert.Equal(t, buffer, source.Buffer(), "the buffer should be kept")
+	errView.Clear()
+	redoHandler(g, source)
+	assert.Contains(t, errView.Buffer(), ErrStaleHistory.Error())
+
+	// the panes are only synchronized after a modification
+	layout(g)
+	source.Clear()
+	layout(g)
+	assert.Equal(t, "", source.Buffer(), "the pane should not be written again")
+	writeInView(clone, "bar")
+	layout(g)
+	assert.Equal(t, clone.Buffer(), source.Buffer())
+
+	unsplit(g)
+	assert.False(t, staleHistories[source.Name()], "the history should be given back once unsplit")
+	errView.Clear()
+	undoHandler(g, source)
+	assert.Empty(t, errView.Buffer(), "the buffer in a single pane may undo")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// defaultSwapInterval is the delay between two writes of the swap files
+const defaultSwapInterval = 4 * time.Second
+
+// swapFile is the swap file written for a file view
+type swapFile struct {
+	path string
+	hash [sha1.Size]byte // hash of the content last written
+}
+
+var (
+	// swapFiles gives the swap file of each file view with unsaved
+	// modifications
+	swapFiles = map[string]*swapFile{}
+	// lastSwapWrite is the last time the swap files were updated
+	lastSwapWrite time.Time
+
+	// swapMutex serializes the writes of the swap files, which are made
+	// in the background
+	swapMutex sync.Mutex
+	// swapGenerations is incremented each time a swap file is removed so
+	// that a pending write does not bring it back
+	swapGenerations = map[string]int{}
+)
+
+// swapHeader is the first line of the swap files, followed by the id of
+// the process writing it, so that a running stretto keeps its swap files
+const swapHeader = "stretto swap "
+
+// swapData returns the content of the swap file of a buffer
+func swapData(content string) []byte {
+	return []byte(fmt.Sprintf("%s%d\n%s", swapHeader, os.Getpid(), content))
+}
+
+// readSwap returns the buffer saved in the swap file and the id of the
+// process which wrote it, 0 if it is unknown
+func readSwap(path string) ([]byte, int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	i := bytes.IndexByte(data, '\n')
+	if !bytes.HasPrefix(data, []byte(swapHeader)) || i < 0 {
+		return data, 0, nil
+	}
+	pid, err := strconv.Atoi(string(data[len(swapHeader):i]))
+	if err != nil {
+		return data, 0, nil
+	}
+	return data[i+1:], pid, nil
+}
+
+// swapOwner returns the id of the other running stretto writing the swap
+// file, 0 if there is none
+func swapOwner(path string) int {
+	_, pid, err := readSwap(path)
+	if err != nil || pid == 0 || pid == os.Getpid() || !processRunning(pid) {
+		return 0
+	}
+	return pid
+}
+
+// swapPath returns the path of the swap file of a file :
+// dir/file.txt is saved in dir/.file.txt.stretto.swp
+func swapPath(filename string) string {
+	dir, name := filepath.Split(filename)
+	return filepath.Join(dir, "."+name+".stretto.swp")
+}
+
+func swapInterval() time.Duration {
+	if userconfig.Swapinterval > 0 {
+		return time.Duration(userconfig.Swapinterval) * time.Second
+	}
+	return defaultSwapInterval
+}
+
+// writeSwapAsync writes the content in the swap file in the background
+func writeSwapAsync(path string, content []byte) {
+	swapMutex.Lock()
+	gen := swapGenerations[path]
+	swapMutex.Unlock()
+	go func() {
+		swapMutex.Lock()
+		defer swapMutex.Unlock()
+		if swapGenerations[path] == gen {
+			ioutil.WriteFile(path, content, 0600)
+		}
+	}()
+}
+
+func removeSwap(path string) {
+	swapMutex.Lock()
+	defer swapMutex.Unlock()
+	swapGenerations[path]++
+	os.Remove(path)
+}
+
+// removeSwapFile removes the swap file of a view
+func removeSwapFile(viewName string) {
+	if s, ok := swapFiles[viewName]; ok {
+		removeSwap(s.path)
+		delete(swapFiles, viewName)
+	}
+}
+
+// removeSwapFiles removes the swap files of all the views
+func removeSwapFiles() {
+	for name := range swapFiles {
+		removeSwapFile(name)
+	}
+}
+
+// refreshSwapFiles writes the swap files of the modified file views, and
+// removes the ones of the saved views. It is run by the timer, and does
+// nothing until the swap interval is elapsed.
+func refreshSwapFiles(g *gocui.Gui) {
+	if userconfig.Swapinterval < 0 || time.Since(lastSwapWrite) < swapInterval() {
+		return
+	}
+	lastSwapWrite = time.Now()
+	for _, name := range fileViewNames() {
+		v, err := g.View(name)
+		if err != nil {
+			continue
+		}
+		s, ok := swapFiles[name]
+		if filePath(v) == "" || !isDirty(v) {
+			if ok {
+				removeSwapFile(name)
+			}
+			continue
+		}
+		path := swapPath(filePath(v))
+		if ok && s.path != path {
+			removeSwapFile(name)
+			ok = false
+		}
+		if !ok {
+			if swapOwner(path) != 0 {
+				// the file is edited by another stretto
+				continue
+			}
+			s = &swapFile{path: path}
+			swapFiles[name] = s
+		}
+		content := strings.TrimSuffix(v.Buffer(), "\n")
+		if h := sha1.Sum([]byte(content)); h != s.hash {
+			s.hash = h
+			writeSwapAsync(path, swapData(content))
+		}
+	}
+}
+
+// offerRecovery asks, for each view in turn, to recover the content of its
+// swap file. It returns the demonInput handling the first answer, or nil
+// when there is no swap file. The swap files of the other running stretto
+// are left alone.
+func offerRecovery(g *gocui.Gui, views ...*gocui.View) demonInput {
+	for i, v := range views {
+		if d := askRecovery(g, v, views[i+1:]); d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// askRecovery asks to recover the swap file of the view, then goes on with
+// the next views. Only "y" and "n" are answers, the question is asked again
+// otherwise.
+func askRecovery(g *gocui.Gui, v *gocui.View, next []*gocui.View) demonInput {
+	if v == nil || filePath(v) == "" {
+		return nil
+	}
+	path := swapPath(filePath(v))
+	content, _, err := readSwap(path)
+	if err != nil {
+		return nil
+	}
+	if pid := swapOwner(path); pid != 0 {
+		displayError(g, fmt.Errorf("%s is edited by another stretto (process %d)", filePath(v), pid))
+		return nil
+	}
+	question := fmt.Sprintf("Swap file found for %s, recover it (y/n)", filePath(v))
+	interactive(g, question)
+	var answer demonInput
+	answer = func(g *gocui.Gui, input string) (demonInput, error) {
+		switch input {
+		case "y":
+			v.Clear()
+			fmt.Fprintf(v, "%s", content)
+			forgetRender(v.Name())
+			bufferEdited(v, 0)
+			v.SetOrigin(0, 0)
+			v.SetCursor(0, 0)
+			swapFiles[v.Name()] = &swapFile{path: path, hash: sha1.Sum(content)}
+		case "n":
+			removeSwap(path)
+		default:
+			interactive(g, question)
+			return answer, nil
+		}
+		return offerRecovery(g, next...), nil
+	}
+	return answer
+}
+
+// backupFile copies the file in file~ before it is overwritten
+func backupFile(filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename+"~", content)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwapPath(t *testing.T) {
+	assert.Equal(t, ".foo.txt.stretto.swp", swapPath("foo.txt"))
+	assert.Equal(t, filepath.Join("dir", ".foo.txt.stretto.swp"), swapPath("dir/foo.txt"))
+}
+
+func TestRecovery(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	ioutil.WriteFile(filename, []byte("saved"), 0644)
+
+	openAndDisplayFile(g, filename)
+	assert.Nil(t, offerRecovery(g, g.Workingview()), "no swap file, nothing to recover")
+
+	ioutil.WriteFile(swapPath(filename), []byte("modified"), 0600)
+	d := offerRecovery(g, g.Workingview())
+	assert.NotNil(t, d, "the swap file should be found")
+	d(g, "y")
+	assert.Equal(t, "modified\n", g.Workingview().Buffer())
+	assert.True(t, isDirty(g.Workingview()), "recovered modifications are not saved")
+
+	saveMain(g.Workingview(), filename)
+	_, err := os.Stat(swapPath(filename))
+	assert.True(t, os.IsNotExist(err), "the swap file should be removed once saved")
+}
+
+func TestRecoveryAnswers(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	ioutil.WriteFile(first, []byte("saved"), 0644)
+	ioutil.WriteFile(second, []byte("saved"), 0644)
+	openAndDisplayFile(g, first)
+	v1 := g.Workingview()
+	openAndDisplayFile(g, second)
+	v2 := g.Workingview()
+	ioutil.WriteFile(swapPath(first), []byte("first swap"), 0600)
+	ioutil.WriteFile(swapPath(second), swapData("second swap"), 0600)
+
+	d := offerRecovery(g, v1, v2)
+	assert.NotNil(t, d, "the swap file should be found")
+	d, _ = d(g, "")
+	assert.NotNil(t, d, "an empty answer should ask again")
+	d, _ = d(g, "yes")
+	assert.NotNil(t, d, "an unknown answer should ask again")
+	_, err := os.Stat(swapPath(first))
+	assert.Nil(t, err, "the swap file should be kept until the answer is given")
+
+	d, _ = d(g, "n")
+	assert.NotNil(t, d, "the swap file of the second file should be offered")
+	_, err = os.Stat(swapPath(first))
+	assert.True(t, os.IsNotExist(err), "n should remove the swap file")
+	assert.Equal(t, "saved\n", v1.Buffer())
+
+	d, _ = d(g, "y")
+	assert.Nil(t, d, "there is no other swap file")
+	assert.Equal(t, "second swap\n", v2.Buffer(), "the header of the swap file should not be recovered")
+	removeSwapFile(v2.Name())
+}
+
+func TestSwapOfRunningProcess(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	ioutil.WriteFile(filename, []byte("saved"), 0644)
+	path := swapPath(filename)
+	// the swap file of the process which started the tests
+	ioutil.WriteFile(path, []byte(fmt.Sprintf("%s%d\nother", swapHeader, os.Getppid())), 0600)
+
+	openAndDisplayFile(g, filename)
+	v := g.Workingview()
+	defer closeView(g, v)
+	assert.Nil(t, offerRecovery(g, v), "the swap file of a running stretto should not be offered")
+
+	writeInView(v, "x")
+	lastSwapWrite = time.Time{}
+	runTimerTasks(g)
+	_, ok := swapFiles[v.Name()]
+	assert.False(t, ok, "the swap file of a running stretto should not be written")
+	content, pid, err := readSwap(path)
+	assert.Nil(t, err, "the swap file should be kept")
+	assert.Equal(t, "other", string(content))
+	assert.Equal(t, os.Getppid(), pid)
+}
+
+func TestBackup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+
+	assert.Nil(t, backupFile(filename), "nothing to backup")
+	ioutil.WriteFile(filename, []byte("previous"), 0644)
+	assert.Nil(t, backupFile(filename))
+	assert.Equal(t, "previous", getContentFile(filename+"~"))
+}
+
+func TestSwapTimer(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	ioutil.WriteFile(filename, []byte("saved"), 0644)
+
+	openAndDisplayFile(g, filename)
+	v := g.Workingview()
+	defer closeView(g, v)
+	writeInView(v, "x")
+	lastSwapWrite = time.Time{}
+	runTimerTasks(g)
+	_, ok := swapFiles[v.Name()]
+	assert.True(t, ok, "the swap file should be written by the timer")
+	assert.False(t, lastSwapWrite.IsZero())
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// token is a part of a line, in bytes, belonging to a syntax class
+// (keyword, string, comment...)
+type token struct {
+	start, end int
+	class      string
+}
+
+// syntaxRule matches a token at the position of the tokenizer. Only the
+// group of the pattern is colored, the whole match is consumed.
+type syntaxRule struct {
+	class     string
+	re        *regexp.Regexp
+	group     int
+	lineStart bool // only at the beginning of the line
+}
+
+// syntaxBlock is a token which may span several lines, such as block
+// comments or raw strings
+type syntaxBlock struct {
+	class      string
+	start, end *regexp.Regexp
+	lineStart  bool
+}
+
+// language gives the rules of the files of some extensions. The blocks are
+// tried before the rules, in order.
+type language struct {
+	name       string
+	extensions []string
+	blocks     []syntaxBlock
+	rules      []syntaxRule
+}
+
+func rule(class, pattern string) syntaxRule {
+	return syntaxRule{class: class, re: regexp.MustCompile(`^(?:` + pattern + `)`)}
+}
+
+// groupRule colors only the first group of the pattern
+func groupRule(class, pattern string) syntaxRule {
+	r := rule(class, pattern)
+	r.group = 1
+	return r
+}
+
+func lineStartRule(class, pattern string) syntaxRule {
+	r := rule(class, pattern)
+	r.lineStart = true
+	return r
+}
+
+func block(class, start, end string) syntaxBlock {
+	return syntaxBlock{class: class, start: regexp.MustCompile(`^(?:` + start + `)`), end: regexp.MustCompile(end)}
+}
+
+func words(words ...string) string {
+	return `(?:` + strings.Join(words, "|") + `)\b`
+}
+
+const (
+	doubleQuoted = `"(?:\\.|[^"\\])*"?`
+	singleQuoted = `'(?:\\.|[^'\\])*'?`
+	number       = `-?(?:0[xX][0-9a-fA-F]+|[0-9]+(?:\.[0-9]*)?(?:[eE][+-]?[0-9]+)?)\b`
+	identifier   = `[A-Za-z_][A-Za-z0-9_]*`
+)
+
+var languages = []*language{
+	{
+		name:       "go",
+		extensions: []string{".go"},
+		blocks: []syntaxBlock{
+			block("comment", `/\*`, `\*/`),
+			block("string", "`", "`"),
+		},
+		rules: []syntaxRule{
+			rule("comment", `//.*`),
+			rule("string", doubleQuoted),
+			rule("string", singleQuoted),
+			rule("keyword", words("break", "case", "chan", "const", "continue", "default",
+				"defer", "else", "fallthrough", "for", "func", "go", "goto", "if",
+				"import", "interface", "map", "package", "range", "return", "select",
+				"struct", "switch", "type", "var")),
+			rule("type", words("bool", "byte", "complex64", "complex128", "error",
+				"float32", "float64", "int", "int8", "int16", "int32", "int64", "rune",
+				"string", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr")),
+			rule("constant", words("true", "false", "nil", "iota")),
+			rule("number", number),
+			rule("", identifier),
+		},
+	},
+	{
+		name:       "json",
+		extensions: []string{".json"},
+		rules: []syntaxRule{
+			groupRule("key", `(`+doubleQuoted+`)\s*:`),
+			rule("string", doubleQuoted),
+			rule("constant", words("true", "false", "null")),
+			rule("number", number),
+			rule("", identifier),
+		},
+	},
+	{
+		name:       "markdown",
+		extensions: []string{".md", ".markdown"},
+		blocks: []syntaxBlock{
+			{class: "code", start: regexp.MustCompile("^```"), end: regexp.MustCompile("```"), lineStart: true},
+		},
+		rules: []syntaxRule{
+			lineStartRule("heading", `#{1,6}\s.*`),
+			lineStartRule("keyword", `\s*(?:[-*+]|[0-9]+\.)\s`),
+			rule("code", "`[^`]+`"),
+			rule("emphasis", `\*\*[^*]+\*\*|__[^_]+__|\*[^*\s][^*]*\*`),
+			rule("link", `\[[^\]]*\]\([^)]*\)`),
+			rule("", `\w+`),
+		},
+	},
+	{
+		name:       "shell",
+		extensions: []string{".sh", ".bash", ".zsh"},
+		rules: []syntaxRule{
+			rule("variable", `\$(?:`+identifier+`|\{[^}]*\}|[0-9#?@*$!-])`),
+			rule("comment", `#.*`),
+			rule("string", doubleQuoted),
+			rule("string", `'[^']*'?`),
+			rule("keyword", words("if", "then", "else", "elif", "fi", "for", "while",
+				"until", "do", "done", "case", "esac", "function", "in", "select",
+				"return", "local", "export", "break", "continue")),
+			rule("number", number),
+			rule("", `[\w.\-/]+`),
+		},
+	},
+	{
+		name:       "yaml",
+		extensions: []string{".yaml", ".yml"},
+		rules: []syntaxRule{
+			rule("comment", `#.*`),
+			lineStartRule("keyword", `(?:---|\.\.\.)(?:\s|$)`),
+			{class: "key", group: 1, lineStart: true,
+				re: regexp.MustCompile(`^\s*(?:-\s+)?([^\s#:'"-][^#:]*?|` + doubleQuoted + `|` + singleQuoted + `)\s*:(?:\s|$)`)},
+			rule("string", doubleQuoted),
+			rule("string", singleQuoted),
+			rule("constant", words("true", "false", "null", "yes", "no", "True", "False", "Null")+`|~`),
+			rule("number", number),
+			rule("variable", `[&*][\w-]+`),
+			rule("", `[\w.\-/]+`),
+		},
+	},
+}
+
+// defaultSyntaxColors are the colors of the syntax classes which are not
+// configured in syntaxcolors
+var defaultSyntaxColors = map[string]string{
+	"comment":  "blue",
+	"keyword":  "yellow",
+	"type":     "green",
+	"string":   "magenta",
+	"number":   "magenta",
+	"constant": "magenta",
+	"key":      "cyan",
+	"variable": "cyan",
+	"heading":  "yellow",
+	"emphasis": "magenta",
+	"code":     "green",
+	"link":     "blue",
+}
+
+// languageFor returns the language of the file from its extension, or nil
+func languageFor(filename string) *language {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, l := range languages {
+		for _, e := range l.extensions {
+			if e == ext {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// viewLanguages gives the language of the file views, by view name
+var viewLanguages = map[string]*language{}
+
+// lineTokens are the tokens of a line and the state of the tokenizer at
+// its end : 0, or the index (starting at 1) of the block still opened
+type lineTokens struct {
+	tokens []token
+	end    int
+}
+
+// syntaxCaches keeps, for each view, the tokens of its first lines, up to
+// the last line displayed. An edit drops the lines from the edited one, the
+// lines above and their states are kept.
+var syntaxCaches = map[string][]lineTokens{}
+
+// syntaxEdited drops the tokens of the lines of the view from the line y
+func syntaxEdited(v *gocui.View, y int) {
+	if cache := syntaxCaches[v.Name()]; y < len(cache) {
+		syntaxCaches[v.Name()] = cache[:y]
+	}
+}
+
+// setLanguage picks the language of the view from the file extension
+func setLanguage(v *gocui.View, filename string) {
+	delete(syntaxCaches, v.Name())
+	forgetRender(v.Name())
+	if l := languageFor(filename); l != nil {
+		viewLanguages[v.Name()] = l
+	} else {
+		delete(viewLanguages, v.Name())
+	}
+}
+
+// languageOf returns the language of the view, nil for the large files
+func languageOf(v *gocui.View) *language {
+	if _, ok := largeFiles[v.Name()]; ok {
+		return nil
+	}
+	return viewLanguages[sourceOf(v.Name())]
+}
+
+// tokenizeLine returns the tokens of the line, starting in the state, and
+// the state at the end of the line
+func (l *language) tokenizeLine(line string, state int) ([]token, int) {
+	var tokens []token
+	pos := 0
+	if state > 0 {
+		b := l.blocks[state-1]
+		loc := b.end.FindStringIndex(line)
+		if loc == nil {
+			return []token{{0, len(line), b.class}}, state
+		}
+		tokens = append(tokens, token{0, loc[1], b.class})
+		pos = loc[1]
+	}
+next:
+	for pos < len(line) {
+		rest := line[pos:]
+		for i, b := range l.blocks {
+			if b.lineStart && pos > 0 {
+				continue
+			}
+			loc := b.start.FindStringIndex(rest)
+			if loc == nil {
+				continue
+			}
+			end := b.end.FindStringIndex(rest[loc[1]:])
+			if end == nil {
+				return append(tokens, token{pos, len(line), b.class}), i + 1
+			}
+			stop := pos + loc[1] + end[1]
+			tokens = append(tokens, token{pos, stop, b.class})
+			pos = stop
+			continue next
+		}
+		for _, r := range l.rules {
+			if r.lineStart && pos > 0 {
+				continue
+			}
+			loc := r.re.FindStringSubmatchIndex(rest)
+			if loc == nil || loc[1] == 0 {
+				continue
+			}
+			if s, e := loc[2*r.group], loc[2*r.group+1]; r.class != "" && s >= 0 && s < e {
+				tokens = append(tokens, token{pos + s, pos + e, r.class})
+			}
+			pos += loc[1]
+			continue next
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		pos += size
+	}
+	return tokens, 0
+}
+
+// syntaxColor returns the color of the syntax class
+func syntaxColor(class string) gocui.Attribute {
+	if c, ok := userconfig.Syntaxcolors[class]; ok {
+		return setColor(c)
+	}
+	return setColor(defaultSyntaxColors[class])
+}
+
+// syntaxSpans returns the spans of the tokens of the lines from first to
+// last. The lines above which are not in the cache are tokenized too, for
+// the blocks they open.
+func syntaxSpans(v *gocui.View, lines []string, first, last int) map[int][]span {
+	spans := map[int][]span{}
+	lang := languageOf(v)
+	if lang == nil {
+		return spans
+	}
+	cache := syntaxCaches[v.Name()]
+	for y := len(cache); y <= last && y < len(lines); y++ {
+		state := 0
+		if y > 0 {
+			state = cache[y-1].end
+		}
+		var lt lineTokens
+		lt.tokens, lt.end = lang.tokenizeLine(lines[y], state)
+		cache = append(cache, lt)
+	}
+	syntaxCaches[v.Name()] = cache
+	for y := first; y <= last && y < len(cache); y++ {
+		for _, t := range cache[y].tokens {
+			if fg := syntaxColor(t.class); fg != gocui.ColorDefault {
+				spans[y] = append(spans[y], span{t.start, t.end, fg, gocui.ColorDefault})
+			}
+		}
+	}
+	return spans
+}
+
+// overlaySpans returns the spans of top drawn over the spans of base. Both
+// must be sorted and must not overlap.
+func overlaySpans(base, top []span) []span {
+	if len(top) == 0 {
+		return base
+	}
+	var spans []span
+	for _, b := range base {
+		for _, t := range top {
+			if t.end <= b.start || t.start >= b.end {
+				continue
+			}
+			if t.start > b.start {
+				spans = append(spans, span{b.start, t.start, b.fg, b.bg})
+			}
+			b.start = t.end
+		}
+		if b.start < b.end {
+			spans = append(spans, b)
+		}
+	}
+	spans = append(spans, top...)
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	return spans
+}
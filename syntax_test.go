@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretto-editor/gocui"
+)
+
+// classes returns the text of the tokens of the line by class
+func classes(line string, tokens []token) map[string][]string {
+	m := map[string][]string{}
+	for _, t := range tokens {
+		m[t.class] = append(m[t.class], line[t.start:t.end])
+	}
+	return m
+}
+
+func TestLanguageFor(t *testing.T) {
+	assert.Equal(t, "go", languageFor("main.go").name)
+	assert.Equal(t, "yaml", languageFor("a/b.YML").name)
+	assert.Equal(t, "markdown", languageFor("Commands.md").name)
+	assert.Nil(t, languageFor("LICENSE"))
+}
+
+func TestTokenizeLine(t *testing.T) {
+	golang := languageFor("main.go")
+	line := `	if s := "a // b"; s != nil { // comment`
+	tokens, state := golang.tokenizeLine(line, 0)
+	assert.Equal(t, 0, state)
+	assert.Equal(t, map[string][]string{
+		"keyword":  {"if"},
+		"string":   {`"a // b"`},
+		"constant": {"nil"},
+		"comment":  {"// comment"},
+	}, classes(line, tokens))
+
+	tokens, state = golang.tokenizeLine("x := 1 /* open", 0)
+	assert.Equal(t, 1, state, "the block comment should be opened")
+	assert.Equal(t, []string{"1"}, classes("x := 1 /* open", tokens)["number"])
+	tokens, state = golang.tokenizeLine("still */ return", state)
+	assert.Equal(t, 0, state, "the block comment should be closed")
+	assert.Equal(t, map[string][]string{
+		"comment": {"still */"},
+		"keyword": {"return"},
+	}, classes("still */ return", tokens))
+
+	line = `  "wrap" : true,`
+	tokens, _ = languageFor("a.json").tokenizeLine(line, 0)
+	assert.Equal(t, map[string][]string{
+		"key":      {`"wrap"`},
+		"constant": {"true"},
+	}, classes(line, tokens))
+
+	line = "- name: $HOME # home"
+	tokens, _ = languageFor("a.yaml").tokenizeLine(line, 0)
+	assert.Equal(t, []string{"name"}, classes(line, tokens)["key"])
+	assert.Equal(t, []string{"# home"}, classes(line, tokens)["comment"])
+
+	line = `echo "$HOME" # home`
+	tokens, _ = languageFor("a.sh").tokenizeLine(line, 0)
+	assert.Equal(t, []string{`"$HOME"`}, classes(line, tokens)["string"])
+
+	tokens, _ = languageFor("a.md").tokenizeLine("## Title `code`", 0)
+	assert.Equal(t, []string{"## Title `code`"}, classes("## Title `code`", tokens)["heading"])
+}
+
+func TestOverlaySpans(t *testing.T) {
+	base := []span{{0, 4, gocui.ColorBlue, gocui.ColorDefault}, {6, 10, gocui.ColorRed, gocui.ColorDefault}}
+	top := []span{{2, 7, gocui.ColorBlack, gocui.ColorYellow}}
+	assert.Equal(t, []span{
+		{0, 2, gocui.ColorBlue, gocui.ColorDefault},
+		{2, 7, gocui.ColorBlack, gocui.ColorYellow},
+		{7, 10, gocui.ColorRed, gocui.ColorDefault},
+	}, overlaySpans(base, top))
+	assert.Equal(t, base, overlaySpans(base, nil))
+}
+
+func TestSyntaxHighlight(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	openAndDisplayFile(g, "stretto.json")
+	v := g.Workingview()
+	assert.Equal(t, "json", languageOf(v).name)
+	buffer := v.Buffer()
+	layout(g)
+	assert.Equal(t, buffer, v.Buffer(), "the colors should not change the content")
+	assert.NotEmpty(t, syntaxCaches[v.Name()], "the visible lines should be tokenized")
+
+	spans := syntaxSpans(v, bufferLines(v), 0, 5)
+	assert.Equal(t, span{2, 8, syntaxColor("key"), gocui.ColorDefault}, spans[1][0], `"wrap" is a key`)
+
+	// the search matches are drawn over the syntax
+	setSearchHighlight(v, regexp.MustCompile("wrap"))
+	layout(g)
+	assert.Equal(t, buffer, v.Buffer())
+	clearSearchHighlight(v)
+
+	closeView(g, v)
+	assert.Nil(t, viewLanguages["stretto.json"], "the language should be forgotten")
+}
+
+func TestSyntaxFromEditedLine(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "a.go")
+	ioutil.WriteFile(filename, []byte("package a\n\nvar a = 1\nvar b = 2\n"), 0644)
+	assert.Nil(t, openAndDisplayFile(g, filename))
+	v := g.Workingview()
+	defer closeView(g, v)
+	layout(g)
+	assert.Equal(t, 5, len(syntaxCaches[v.Name()]), "the visible lines should be tokenized")
+	first := syntaxCaches[v.Name()][0].tokens
+
+	// a block opened on the third line
+	v.SetCursor(0, 2)
+	writeInView(v, "/*")
+	assert.Equal(t, 2, len(syntaxCaches[v.Name()]), "the lines from the edited one should be dropped")
+	layout(g)
+	cache := syntaxCaches[v.Name()]
+	assert.True(t, &first[0] == &cache[0].tokens[0], "the lines above should not be tokenized again")
+	assert.Equal(t, 1, cache[2].end, "the block should stay opened")
+	assert.Equal(t, []token{{0, 9, "comment"}}, cache[3].tokens)
+}
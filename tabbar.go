@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stretto-editor/gocui"
+)
+
+const tabbarViewName = "tabbar"
+
+// tabbarStale is set when a buffer is opened, closed or moved, or when its
+// markers change : the tab bar is built again by the next refresh
+var tabbarStale = true
+
+// tabbarBuilt is the working buffer and the width of the tab bar when it
+// was last built
+var tabbarBuilt struct {
+	working string
+	width   int
+}
+
+// tabbarTop returns the first line of the file views : the line below the
+// tab bar when it is displayed
+func tabbarTop() int {
+	if userconfig.Tabbar {
+		return 1
+	}
+	return 0
+}
+
+func updateTabbarGeom(maxX, maxY int) {
+	t, _ := requiredViewsInfo[tabbarViewName]
+	// only the line between the frames is on the screen, the bottom frame
+	// is shared with the file views
+	t.x, t.y, t.w, t.h = -1, -1, maxX+1, 2
+}
+
+// tabLabel returns the label of the buffer in the tab bar : its name and
+// its markers
+func tabLabel(g *gocui.Gui, name string) string {
+	label := " " + name + " "
+	if v, err := g.View(name); err == nil {
+		if m := viewMarkers(v); m != "" {
+			label += m + " "
+		}
+	}
+	return label
+}
+
+// tabbarLine returns the line of the tab bar holding in width and the span
+// of the tab of the working buffer. The first tabs are dropped when the
+// working one does not hold in the line. The width is counted in runes,
+// the span in bytes.
+func tabbarLine(g *gocui.Gui, width int) (string, span) {
+	var labels []string
+	current := -1
+	working := ""
+	if v := g.Workingview(); v != nil {
+		working = sourceOf(v.Name())
+	}
+	for i, name := range fileViewNames() {
+		if name == working {
+			current = i
+		}
+		labels = append(labels, tabLabel(g, name))
+	}
+	first := 0
+	for current >= 0 && first < current && utf8.RuneCountInString(strings.Join(labels[first:current+1], "|")) > width {
+		first++
+	}
+	var line string
+	var tab span
+	for i := first; i < len(labels); i++ {
+		if i > first {
+			line += "|"
+		}
+		if i == current {
+			tab = span{start: len(line), end: len(line) + len(labels[i])}
+		}
+		line += labels[i]
+	}
+	if utf8.RuneCountInString(line) > width && width >= 0 {
+		line = line[:runeToByte(line, width)]
+		if tab.end > len(line) {
+			tab.end = len(line)
+		}
+		if tab.start > tab.end {
+			tab.start = tab.end
+		}
+	}
+	return line, tab
+}
+
+// refreshTabBar lists the opened buffers in the tab bar, the working one
+// drawn with the selection colors. The tab bar is hidden if disabled in
+// the configuration. It is only built again when the buffers, their
+// markers, the working buffer or the width changed.
+func refreshTabBar(g *gocui.Gui) {
+	v, err := g.View(tabbarViewName)
+	if err != nil {
+		return
+	}
+	v.Hidden = !userconfig.Tabbar
+	if v.Hidden {
+		tabbarStale = true
+		return
+	}
+	width, _ := v.Size()
+	working := ""
+	if w := g.Workingview(); w != nil {
+		working = sourceOf(w.Name())
+	}
+	if !tabbarStale && tabbarBuilt.working == working && tabbarBuilt.width == width {
+		return
+	}
+	tabbarStale = false
+	tabbarBuilt.working, tabbarBuilt.width = working, width
+	line, tab := tabbarLine(g, width)
+	fg, bg := setColor(userconfig.Selfgcolor), setColor(userconfig.Selbgcolor)
+	if fg == gocui.ColorDefault && bg == gocui.ColorDefault {
+		fg, bg = gocui.ColorBlack, gocui.ColorWhite
+	}
+	tab.fg, tab.bg = fg, bg
+	var buf bytes.Buffer
+	if tab.end > tab.start {
+		renderLine(&buf, line, []span{tab})
+	} else {
+		buf.WriteString(line)
+	}
+	v.Clear()
+	v.Write(buf.Bytes())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTabBar(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+	userconfig.Tabbar = true
+	defer func() { userconfig.Tabbar = false }()
+
+	openAndDisplayFile(g, "stretto.json")
+	layout(g)
+	tabbar, _ := g.View(tabbarViewName)
+	assert.False(t, tabbar.Hidden, "the tab bar should be displayed")
+	assert.Equal(t, 1, requiredViewsInfo["stretto.json"].y, "the file views should be below the tab bar")
+
+	line, tab := tabbarLine(g, 80)
+	assert.Contains(t, line, " stretto.json ")
+	assert.Equal(t, " stretto.json ", line[tab.start:tab.end], "the working buffer should be highlighted")
+
+	// the tab bar is only built again when it changes
+	tabbar.Clear()
+	layout(g)
+	assert.Equal(t, "", tabbar.Buffer(), "the tab bar should not be built again")
+	writeInView(g.Workingview(), "foo")
+	layout(g)
+	assert.Contains(t, tabbar.Buffer(), " stretto.json [+] ", "the modified buffers should be marked")
+	tabbar.Clear()
+	writeInView(g.Workingview(), "bar")
+	layout(g)
+	assert.Equal(t, "", tabbar.Buffer(), "the markers did not change")
+
+	newFileHandler(g, nil)
+	name := g.Workingview().Name()
+	assert.Contains(t, strings.TrimSpace(tabbar.Buffer()), name, "the tab bar should be updated")
+	line, tab = tabbarLine(g, 80)
+	assert.Equal(t, " "+name+" ", line[tab.start:tab.end])
+
+	switchBufferForward(g, nil)
+	line, tab = tabbarLine(g, 80)
+	assert.NotEqual(t, " "+name+" ", line[tab.start:tab.end])
+
+	// the working tab is kept on the screen
+	showBuffer(g, name)
+	line, tab = tabbarLine(g, len(name)+2)
+	assert.Equal(t, " "+name+" ", line)
+
+	closeView(g, g.Workingview())
+	assert.NotContains(t, tabbar.Buffer(), name, "the tab bar should be updated")
+
+	userconfig.Tabbar = false
+	layout(g)
+	assert.True(t, tabbar.Hidden, "the tab bar should be hidden")
+	assert.Equal(t, 0, requiredViewsInfo["stretto.json"].y)
+}
+
+func TestTabBarMultibyte(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "été.txt")
+	ioutil.WriteFile(filename, []byte("foo"), 0644)
+	assert.Nil(t, openAndDisplayFile(g, filename))
+	v := g.Workingview()
+	defer closeView(g, v)
+
+	label := tabLabel(g, v.Name())
+	line, tab := tabbarLine(g, utf8.RuneCountInString(label))
+	assert.Equal(t, label, line, "the tab should hold in its width in runes")
+	assert.Equal(t, label, line[tab.start:tab.end])
+
+	// the width ends on the first é
+	width := utf8.RuneCountInString(label[:strings.Index(label, "é")]) + 1
+	line, tab = tabbarLine(g, width)
+	assert.True(t, utf8.ValidString(line), "a character should not be cut")
+	assert.True(t, strings.HasSuffix(line, "é"))
+	assert.Equal(t, width, utf8.RuneCountInString(line))
+	assert.Equal(t, line, line[tab.start:tab.end])
+}
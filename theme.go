@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+	"github.com/stretto-editor/gocui"
+)
+
+// ErrUnknownTheme raised when the theme file does not exist
+var ErrUnknownTheme = errors.New("no theme with this name")
+
+// defaultTheme is the name of the colors of the configuration file
+const defaultTheme = "default"
+
+// viewColors are the colors of one of the infoline, error, cmdline,
+// inputline and historic views
+type viewColors struct {
+	Bgcolor string
+	Fgcolor string
+}
+
+// theme gives the colors of the interface. A color is a color name or a
+// number of the 256 colors, with bold, underline or reverse modifiers.
+type theme struct {
+	Guibgcolor  string
+	Guifgcolor  string
+	Viewbgcolor string
+	Viewfgcolor string
+	Selbgcolor  string
+	Selfgcolor  string
+	// colors of the search matches, the selection colors are used if empty
+	Matchbgcolor string
+	Matchfgcolor string
+	// colors of the syntax classes (comment, keyword, type, string, number,
+	// constant, key, variable, heading, emphasis, code, link)
+	Syntaxcolors map[string]string
+	// colors of the infoline, error, cmdline, inputline and historic views
+	Viewcolors map[string]viewColors
+}
+
+// configTheme is the theme of the configuration file, from which the other
+// themes start
+var configTheme theme
+
+func (t theme) copy() theme {
+	syntax := map[string]string{}
+	for k, c := range t.Syntaxcolors {
+		syntax[k] = c
+	}
+	views := map[string]viewColors{}
+	for k, c := range t.Viewcolors {
+		views[k] = c
+	}
+	t.Syntaxcolors, t.Viewcolors = syntax, views
+	return t
+}
+
+// colors returns all the colors of the theme
+func (t theme) colors() []string {
+	colors := []string{t.Guibgcolor, t.Guifgcolor, t.Viewbgcolor, t.Viewfgcolor,
+		t.Selbgcolor, t.Selfgcolor, t.Matchbgcolor, t.Matchfgcolor}
+	for _, c := range t.Syntaxcolors {
+		colors = append(colors, c)
+	}
+	for _, c := range t.Viewcolors {
+		colors = append(colors, c.Bgcolor, c.Fgcolor)
+	}
+	return colors
+}
+
+// themesDirectory is the directory of the theme files. If empty, the themes
+// are looked for in the themes directory of the XDG configuration
+// directory, then in ~/.stretto/themes.
+var themesDirectory = ""
+
+// themesDirs returns the directories of the theme files, the first ones
+// taking precedence
+func themesDirs() []string {
+	if themesDirectory != "" {
+		return []string{themesDirectory}
+	}
+	var dirs []string
+	if dir := xdgConfigDir(); dir != "" {
+		dirs = append(dirs, filepath.Join(dir, "themes"))
+	}
+	if usr, err := user.Current(); err == nil {
+		dirs = append(dirs, filepath.Join(usr.HomeDir, ".stretto", "themes"))
+	}
+	return dirs
+}
+
+// themeFile returns the file of the theme, or an empty string
+func themeFile(name string) string {
+	for _, dir := range themesDirs() {
+		f := filepath.Join(dir, name+".json")
+		if _, err := os.Stat(f); err == nil {
+			return f
+		}
+	}
+	return ""
+}
+
+// themeNames returns the names of the theme files, without extension
+func themeNames() []string {
+	names := []string{defaultTheme}
+	for _, dir := range themesDirs() {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, f := range files {
+			name := strings.TrimSuffix(filepath.Base(f), ".json")
+			if !containsString(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadTheme replaces the colors of the configuration by the colors given
+// in the theme file. The default theme is the colors of the configuration.
+func loadTheme(name string) error {
+	t := configTheme.copy()
+	if name != defaultTheme {
+		f := themeFile(name)
+		if f == "" {
+			return ErrUnknownTheme
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("Could not load the theme %s : %v", name, err)
+		}
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("Could not load the theme %s : %v", name, err)
+		}
+	}
+	for _, c := range t.colors() {
+		if _, err := parseColor(c); err != nil {
+			return fmt.Errorf("Could not load the theme %s : %v", name, err)
+		}
+	}
+	userconfig.theme = t
+	return nil
+}
+
+// uses256Colors returns true if a color of the theme is not one of the
+// eight basic colors
+func (t theme) uses256Colors() bool {
+	for _, c := range t.colors() {
+		if setColor(c)&colorMask > gocui.ColorWhite {
+			return true
+		}
+	}
+	return false
+}
+
+// setFileViewColors gives the colors of the theme to a file view
+func setFileViewColors(v *gocui.View) {
+	v.BgColor = setColor(userconfig.Viewbgcolor)
+	v.FgColor = setColor(userconfig.Viewfgcolor)
+	v.SelBgColor = setColor(userconfig.Selbgcolor)
+	v.SelFgColor = setColor(userconfig.Selfgcolor)
+	if info, ok := requiredViewsInfo[v.Name()]; ok {
+		info.slbgcol, info.slfgcol = v.SelBgColor, v.SelFgColor
+	}
+}
+
+// applyColors gives the colors of the theme to the gui and to all the views
+func applyColors(g *gocui.Gui) {
+	if userconfig.theme.uses256Colors() {
+		termbox.SetOutputMode(termbox.Output256)
+	}
+	g.BgColor = setColor(userconfig.Guibgcolor)
+	g.FgColor = setColor(userconfig.Guifgcolor)
+	for name, info := range requiredViewsInfo {
+		v, err := g.View(name)
+		if err != nil {
+			continue
+		}
+		switch info.c {
+		case "main":
+			setFileViewColors(v)
+		case "tmp":
+			v.SelBgColor = setColor(userconfig.Selbgcolor)
+			v.SelFgColor = setColor(userconfig.Selfgcolor)
+		default:
+			c := userconfig.Viewcolors[name]
+			v.BgColor = setColor(c.Bgcolor)
+			v.FgColor = setColor(c.Fgcolor)
+		}
+	}
+}
+
+// themeCmd switches to the theme given in argument
+func themeCmd(g *gocui.Gui, cmd []string) error {
+	if err := loadTheme(cmd[1]); err != nil {
+		return err
+	}
+	applyColors(g)
+	return nil
+}
+
+// GetAutocompleteTheme returns the name of the theme beginning by the
+// prefix in argument
+func GetAutocompleteTheme(prefix string, posArg int) string {
+	return autocompleteWord(prefix, themeNames())
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretto-editor/gocui"
+)
+
+func TestParseColor(t *testing.T) {
+	c, err := parseColor("red")
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, gocui.ColorRed, c)
+
+	c, err = parseColor("bold underline 208")
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, gocui.Attribute(209)|gocui.AttrBold|gocui.AttrUnderline, c)
+
+	c, _ = parseColor("")
+	assert.Equal(t, gocui.ColorDefault, c)
+
+	_, err = parseColor("256")
+	assert.NotNil(t, err, "the color should be unknown")
+	_, err = parseColor("purple")
+	assert.NotNil(t, err, "the color should be unknown")
+
+	assert.Equal(t, "\x1b[0;1;44m\x1b[38;5;208;1m", colorEscape(setColor("bold 208"), gocui.ColorBlue))
+	assert.Equal(t, "\x1b[0;31m\x1b[48;5;235m", colorEscape(gocui.ColorRed, setColor("235")))
+}
+
+func TestWrite256Colors(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	v := g.Workingview()
+	v.Clear()
+	var buf bytes.Buffer
+	renderLine(&buf, "var x = 1", []span{{0, 3, setColor("bold 208"), setColor("235")}})
+	v.Write(buf.Bytes())
+	line, _ := v.Line(0)
+	assert.Equal(t, "var x = 1", line, "the escape sequences should not be written as text")
+}
+
+func TestThemeCmd(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	themesDirectory = dir
+	defer func() { themesDirectory = "" }()
+	saved := userconfig.theme
+	defer func() { userconfig.theme, configTheme = saved, saved }()
+	configTheme = theme{Guibgcolor: "black", Syntaxcolors: map[string]string{"keyword": "red"}}
+
+	ioutil.WriteFile(filepath.Join(dir, "dark.json"), []byte(`{
+		"guibgcolor" : "235",
+		"syntaxcolors" : { "comment" : "bold 244" },
+		"viewcolors" : { "infoline" : { "bgcolor" : "blue", "fgcolor" : "white" } }
+	}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "wrong.json"), []byte(`{ "guibgcolor" : "purple" }`), 0644)
+
+	assert.Equal(t, []string{"dark", "default", "wrong"}, themeNames())
+	assert.Equal(t, "dark", GetAutocompleteTheme("da", 1))
+
+	err = themeCmd(g, []string{"theme", "dark"})
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, gocui.Attribute(236), g.BgColor)
+	info, _ := g.View("infoline")
+	assert.Equal(t, gocui.ColorBlue, info.BgColor)
+	assert.Equal(t, setColor("bold 244"), syntaxColor("comment"))
+	assert.Equal(t, gocui.ColorRed, syntaxColor("keyword"), "the colors of the configuration are kept")
+
+	assert.NotNil(t, themeCmd(g, []string{"theme", "wrong"}), "the color should be unknown")
+	assert.Equal(t, ErrUnknownTheme, themeCmd(g, []string{"theme", "none"}))
+	assert.Equal(t, gocui.Attribute(236), g.BgColor, "the theme should be kept")
+
+	err = themeCmd(g, []string{"theme", "default"})
+	assert.Nil(t, err, "No error should be found")
+	assert.Equal(t, gocui.ColorBlack, g.BgColor)
+	assert.Equal(t, gocui.ColorDefault, info.BgColor)
+}
+
+func TestThemesDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stretto")
+	assert.Nil(t, err, "No error should be found")
+	defer os.RemoveAll(dir)
+	old := os.Getenv("XDG_CONFIG_HOME")
+	defer os.Setenv("XDG_CONFIG_HOME", old)
+	os.Setenv("XDG_CONFIG_HOME", dir)
+
+	themes := filepath.Join(dir, "stretto", "themes")
+	assert.Equal(t, themes, themesDirs()[0], "the XDG directory should come first")
+	os.MkdirAll(themes, 0755)
+	ioutil.WriteFile(filepath.Join(themes, "light.json"), []byte(`{}`), 0644)
+	assert.Equal(t, filepath.Join(themes, "light.json"), themeFile("light"))
+	assert.Contains(t, themeNames(), "light")
+	assert.Equal(t, "", themeFile("nothing"))
+}
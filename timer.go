@@ -0,0 +1,31 @@
+package main
+
+import (
+	"time"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// timerInterval is the delay between two ticks of the timer
+const timerInterval = time.Second
+
+// timerTasks are run in the main loop on each tick of the timer. Each task
+// checks itself whether its own interval is elapsed.
+var timerTasks = []func(g *gocui.Gui){refreshSwapFiles, checkOpenedFiles}
+
+// startTimer runs the timer tasks regularly, even when the editor is idle
+func startTimer(g *gocui.Gui) {
+	ticker := time.NewTicker(timerInterval)
+	go func() {
+		for range ticker.C {
+			g.Execute(runTimerTasks)
+		}
+	}()
+}
+
+func runTimerTasks(g *gocui.Gui) error {
+	for _, task := range timerTasks {
+		task(g)
+	}
+	return nil
+}
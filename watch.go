@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stretto-editor/gocui"
+)
+
+// fileCheckInterval is the delay between two checks of the opened files
+const fileCheckInterval = 2 * time.Second
+
+const diffViewName = "Diff - file on disk / buffer"
+
+// ErrChangedOnDisk raised when saving a file modified by another program
+// since it was opened or saved
+var ErrChangedOnDisk = errors.New("file changed on disk since it was read, save it with Ctrl+S to choose whether to overwrite it (y/n/d)")
+
+// fileStamp describes the state of a file on disk when it was read or written
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	hash    [sha1.Size]byte
+}
+
+var (
+	// fileStamps gives, for each file view, the state of its file when it
+	// was last opened or saved
+	fileStamps = map[string]fileStamp{}
+	// lastFileCheck is the last time the opened files were checked
+	lastFileCheck time.Time
+)
+
+// stampOf returns the state of the file described by fi, whose content
+// was read or written after fi was taken
+func stampOf(fi os.FileInfo, content []byte) fileStamp {
+	return fileStamp{fi.ModTime(), fi.Size(), sha1.Sum(content)}
+}
+
+// readStamp returns the current state of the file
+func readStamp(filename string) (fileStamp, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return stampOf(fi, content), nil
+}
+
+// setStamp records the state of the file of the view
+func setStamp(v *gocui.View, s fileStamp) {
+	fileStamps[v.Name()] = s
+	shareFileState(v.Name())
+}
+
+// recordStamp reads the state of the file of the view and records it
+func recordStamp(v *gocui.View, filename string) {
+	if s, err := readStamp(filename); err == nil {
+		setStamp(v, s)
+	}
+}
+
+// recordWritten records the state of the file of the view once the data
+// was written in it
+func recordWritten(v *gocui.View, filename string, data []byte) {
+	if fi, err := os.Stat(filename); err == nil {
+		setStamp(v, stampOf(fi, data))
+	}
+}
+
+// changedOnDisk returns true if the file of the view was modified by
+// another program since it was opened or saved
+func changedOnDisk(v *gocui.View) bool {
+	s, ok := fileStamps[v.Name()]
+	if !ok || filePath(v) == "" {
+		return false
+	}
+	fi, err := os.Stat(filePath(v))
+	if err != nil {
+		return false
+	}
+	if fi.ModTime().Equal(s.modTime) && fi.Size() == s.size {
+		return false
+	}
+	current, err := readStamp(filePath(v))
+	if err != nil {
+		return false
+	}
+	if current.hash == s.hash {
+		// only touched, no need to check it again
+		fileStamps[v.Name()] = current
+		return false
+	}
+	return true
+}
+
+// reloadFile reads again the file of the view, keeping the cursor position
+func reloadFile(v *gocui.View) error {
+	cx, cy := v.Cursor()
+	ox, oy := v.Origin()
+	if err := openFile(v, filePath(v)); err != nil {
+		return err
+	}
+	v.SetOrigin(ox, oy)
+	v.SetCursor(cx, cy)
+	return nil
+}
+
+// checkOpenedFiles asks what to do with the file views whose file was
+// modified by another program. It is run by the timer, and does nothing
+// until the check interval is elapsed or while the inputline is used.
+func checkOpenedFiles(g *gocui.Gui) {
+	if currentDemonInput != nil || time.Since(lastFileCheck) < fileCheckInterval {
+		return
+	}
+	lastFileCheck = time.Now()
+	for _, name := range fileViewNames() {
+		if v, err := g.View(name); err == nil && changedOnDisk(v) {
+			currentDemonInput = askReload(g, v)
+			return
+		}
+	}
+}
+
+// askReload asks whether the modified file should be reloaded in the view
+func askReload(g *gocui.Gui, v *gocui.View) demonInput {
+	var ask demonInput
+	ask = func(g *gocui.Gui, input string) (demonInput, error) {
+		switch input {
+		case "r":
+			closeDiff(g)
+			if err := reloadFile(v); err != nil {
+				return nil, err
+			}
+			syncLinkedViews(g, v)
+			return nil, nil
+		case "k":
+			closeDiff(g)
+			recordStamp(v, filePath(v))
+			return nil, nil
+		case "d":
+			if err := showDiff(g, v); err != nil {
+				return nil, err
+			}
+		}
+		interactive(g, fmt.Sprintf("%s changed on disk : (r)eload, (k)eep the buffer, (d)iff", filePath(v)))
+		return ask, nil
+	}
+	interactive(g, fmt.Sprintf("%s changed on disk : (r)eload, (k)eep the buffer, (d)iff", filePath(v)))
+	return ask
+}
+
+// askOverwrite asks whether the file modified by another program should be
+// overwritten by the content of the view
+func askOverwrite(g *gocui.Gui, v *gocui.View) demonInput {
+	var ask demonInput
+	ask = func(g *gocui.Gui, input string) (demonInput, error) {
+		switch input {
+		case "y":
+			closeDiff(g)
+			recordStamp(v, filePath(v))
+			return nil, saveMain(v, filePath(v))
+		case "n":
+			closeDiff(g)
+			return nil, nil
+		case "d":
+			if err := showDiff(g, v); err != nil {
+				return nil, err
+			}
+		}
+		interactive(g, fmt.Sprintf("%s changed on disk, overwrite it (y/n/d)", filePath(v)))
+		return ask, nil
+	}
+	interactive(g, fmt.Sprintf("%s changed on disk, overwrite it (y/n/d)", filePath(v)))
+	return ask
+}
+
+// showDiff displays the differences between the file and the buffer
+func showDiff(g *gocui.Gui, v *gocui.View) error {
+	content, err := ioutil.ReadFile(filePath(v))
+	if err != nil {
+		return err
+	}
+	closeDiff(g)
+	d, err := newTmpView(g, diffViewName)
+	if err != gocui.ErrUnknownView {
+		return err
+	}
+	d.Wrap = false
+	text, _, _ := decodeContent(content)
+	onDisk := strings.Split(text, "\n")
+	inBuffer := strings.Split(strings.TrimSuffix(v.Buffer(), "\n"), "\n")
+	for _, l := range lineDiff(onDisk, inBuffer) {
+		fmt.Fprintln(d, l)
+	}
+	g.SetViewOnTop(d.Name())
+	g.SetViewOnTop("inputline")
+	return nil
+}
+
+func closeDiff(g *gocui.Gui) {
+	if _, err := g.View(diffViewName); err == nil {
+		g.DeleteView(diffViewName)
+		removeInfoView(diffViewName)
+	}
+}
+
+// maxDiffSize bounds the size of the table computed by lineDiff
+const maxDiffSize = 4000000
+
+// lineDiff returns the lines of a and b prefixed by "- " when they are only
+// in a, "+ " when they are only in b and "  " when they are in both
+func lineDiff(a, b []string) []string {
+	var diff []string
+	// common prefix and suffix are kept out of the table
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		p++
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+	for _, l := range a[:p] {
+		diff = append(diff, "  "+l)
+	}
+	ma, mb := a[p:len(a)-s], b[p:len(b)-s]
+
+	if len(ma)*len(mb) > maxDiffSize {
+		for _, l := range ma {
+			diff = append(diff, "- "+l)
+		}
+		for _, l := range mb {
+			diff = append(diff, "+ "+l)
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence
+		// of ma[i:] and mb[j:]
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				diff = append(diff, "  "+ma[i])
+				i++
+				j++
+			case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+				diff = append(diff, "- "+ma[i])
+				i++
+			default:
+				diff = append(diff, "+ "+mb[j])
+				j++
+			}
+		}
+	}
+
+	for _, l := range a[len(a)-s:] {
+		diff = append(diff, "  "+l)
+	}
+	return diff
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineDiff(t *testing.T) {
+	a := []string{"a", "b", "c", "d"}
+	b := []string{"a", "c", "x", "d"}
+	assert.Equal(t, []string{"  a", "- b", "  c", "+ x", "  d"}, lineDiff(a, b))
+	assert.Equal(t, []string{"  a"}, lineDiff([]string{"a"}, []string{"a"}))
+	assert.Equal(t, []string{"- a", "+ b"}, lineDiff([]string{"a"}, []string{"b"}))
+}
+
+func TestChangedOnDisk(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	ioutil.WriteFile(filename, []byte("first"), 0644)
+
+	openAndDisplayFile(g, filename)
+	v := g.Workingview()
+	assert.False(t, changedOnDisk(v))
+
+	ioutil.WriteFile(filename, []byte("modified elsewhere"), 0644)
+	assert.True(t, changedOnDisk(v), "the modification should be detected")
+	assert.Equal(t, ErrChangedOnDisk, saveMain(v, filename), "the file should not be overwritten")
+	assert.Equal(t, "modified elsewhere", getContentFile(filename))
+
+	assert.Nil(t, reloadFile(v))
+	assert.Equal(t, "modified elsewhere\n", v.Buffer())
+	assert.False(t, changedOnDisk(v), "the reloaded file is up to date")
+}
+
+func TestCheckTimer(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	ioutil.WriteFile(filename, []byte("first"), 0644)
+
+	openAndDisplayFile(g, filename)
+	v := g.Workingview()
+	defer closeView(g, v)
+	ioutil.WriteFile(filename, []byte("modified elsewhere"), 0644)
+	lastFileCheck = time.Time{}
+	runTimerTasks(g)
+	assert.NotNil(t, currentDemonInput, "the timer should ask to reload the file")
+	currentDemonInput(g, "r")
+	currentDemonInput = nil
+	assert.Equal(t, "modified elsewhere\n", v.Buffer())
+}
+
+func TestStampOfReadContent(t *testing.T) {
+	g := initGui()
+	defer g.Close()
+
+	dir, _ := ioutil.TempDir("", "stretto")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	ioutil.WriteFile(filename, []byte("first"), 0644)
+
+	openAndDisplayFile(g, filename)
+	v := g.Workingview()
+	defer closeView(g, v)
+	assert.Equal(t, sha1.Sum([]byte("first")), fileStamps[v.Name()].hash,
+		"the stamp should be the one of the content in the buffer")
+
+	writeInView(v, "x")
+	assert.Nil(t, saveMain(v, filename))
+	assert.Equal(t, sha1.Sum([]byte("xfirst")), fileStamps[v.Name()].hash,
+		"the stamp should be the one of the written content")
+	assert.False(t, changedOnDisk(v))
+}